@@ -0,0 +1,94 @@
+package azure
+
+import (
+	"strings"
+)
+
+// aggregations are the aggregation types of Azure Monitor, in the order they are requested, with
+// the suffix of their series
+var aggregations = []struct {
+	name   string
+	suffix string
+}{
+	{"Total", "_tot"},
+	{"Average", "_avg"},
+	{"Minimum", "_min"},
+	{"Maximum", "_max"},
+	{"Count", "_count"},
+}
+
+// IsAggregation checks if the name is an aggregation type of Azure Monitor
+func IsAggregation(name string) bool {
+	return canonicalAggregation(name) != ""
+}
+
+func canonicalAggregation(name string) string {
+	for _, aggregation := range aggregations {
+		if strings.EqualFold(aggregation.name, strings.TrimSpace(name)) {
+			return aggregation.name
+		}
+	}
+
+	return ""
+}
+
+// SelectAggregations returns the requested aggregations supported by the metric, or its primary
+// aggregation when none is requested or supported. Metrics without supported aggregations in
+// their definition accept any aggregation.
+func SelectAggregations(requested []string, primary string, supported []string) []string {
+
+	wanted := make(map[string]bool)
+	for _, name := range requested {
+		wanted[canonicalAggregation(name)] = true
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range supported {
+		allowed[canonicalAggregation(name)] = true
+	}
+
+	selected := []string{}
+	for _, aggregation := range aggregations {
+		if wanted[aggregation.name] && (len(supported) == 0 || allowed[aggregation.name]) {
+			selected = append(selected, aggregation.name)
+		}
+	}
+
+	if len(selected) == 0 {
+		if primary = canonicalAggregation(primary); primary == "" {
+			primary = "Average"
+		}
+		selected = append(selected, primary)
+	}
+
+	return selected
+}
+
+// AggregationSuffix returns the suffix of the series of the aggregation
+func AggregationSuffix(aggregation string) string {
+	for _, known := range aggregations {
+		if strings.EqualFold(known.name, aggregation) {
+			return known.suffix
+		}
+	}
+
+	return "_" + strings.ToLower(aggregation)
+}
+
+// Value returns the value of the aggregation
+func (data *MetricData) Value(aggregation string) float64 {
+	switch canonicalAggregation(aggregation) {
+	case "Total":
+		return data.Total
+	case "Average":
+		return data.Average
+	case "Minimum":
+		return data.Minimum
+	case "Maximum":
+		return data.Maximum
+	case "Count":
+		return data.Count
+	}
+
+	return 0
+}
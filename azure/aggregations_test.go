@@ -0,0 +1,49 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSelectAggregations(t *testing.T) {
+
+	type testSelectAggregations struct {
+		requested   []string
+		primary     string
+		supported   []string
+		expectative string
+	}
+	conditions := []testSelectAggregations{
+		{nil, "Average", []string{"None", "Average", "Minimum", "Maximum", "Total", "Count"}, "Average"},
+		{[]string{"maximum", "count", "total"}, "Average", []string{"Average", "Maximum", "Count"}, "Maximum,Count"},
+		{[]string{"Total"}, "Average", []string{"Average"}, "Average"},
+		{[]string{"Total", "Minimum"}, "", nil, "Total,Minimum"},
+		{nil, "", nil, "Average"},
+	}
+
+	for _, condition := range conditions {
+		selected := strings.Join(SelectAggregations(condition.requested, condition.primary, condition.supported), ",")
+		if selected != condition.expectative {
+			t.Errorf(errorMessageData, condition.expectative, selected)
+		}
+	}
+}
+
+func TestAggregationSuffixAndValue(t *testing.T) {
+
+	data := MetricData{Total: 1, Average: 2, Minimum: 3, Maximum: 4, Count: 5}
+
+	conditions := map[string]float64{"_tot": data.Value("Total"), "_avg": data.Value("average"), "_min": data.Value("Minimum"), "_max": data.Value("Maximum"), "_count": data.Value("Count")}
+	expected := map[string]float64{"_tot": 1, "_avg": 2, "_min": 3, "_max": 4, "_count": 5}
+
+	for suffix, value := range conditions {
+		if value != expected[suffix] {
+			t.Errorf(errorMessageData, fmt.Sprint(expected[suffix]), fmt.Sprint(value))
+		}
+	}
+
+	if AggregationSuffix("Count") != "_count" || AggregationSuffix("total") != "_tot" {
+		t.Errorf(errorMessageData, "_count", AggregationSuffix("Count"))
+	}
+}
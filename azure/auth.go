@@ -4,80 +4,341 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dasa-health/elk-logger"
 )
 
-// GetAccessToken autentica o exporter na azure
+// Credential acquires access tokens from Azure Active Directory for a given audience, such as
+// https://management.azure.com/ or https://api.loganalytics.io
+type Credential interface {
+	GetToken(audience string) (Token, error)
+}
+
+// Token represents an access token issued by Azure Active Directory
+type Token struct {
+	AccessToken string
+	ExpiresOn   time.Time
+	Resource    string
+}
+
+// CredentialConfig holds the settings of a credential profile. The field names match the
+// environment variables used when the exporter runs without a configuration file.
+type CredentialConfig struct {
+	AuthMethod              string `yaml:"authMethod"`
+	TenantID                string `yaml:"tenantId"`
+	ClientID                string `yaml:"clientId"`
+	ClientSecret            Secret `yaml:"clientSecret"`
+	CertificatePath         string `yaml:"certificatePath"`
+	CertificatePassword     Secret `yaml:"certificatePassword"`
+	FederatedTokenFile      string `yaml:"federatedTokenFile"`
+	ManagedIdentityEndpoint string `yaml:"managedIdentityEndpoint"`
+	CredentialChain         string `yaml:"credentialChain"`
+	Cloud                   string `yaml:"cloud"`
+	AuthorityHost           string `yaml:"authorityHost"`
+	ResourceManagerEndpoint string `yaml:"resourceManagerEndpoint"`
+	TokenAudience           string `yaml:"tokenAudience"`
+	ResourcesAPIVersion     string `yaml:"resourcesApiVersion"`
+	MetricsAPIVersion       string `yaml:"metricsApiVersion"`
+}
+
+// CredentialConfigFromEnv reads the credential settings from the environment variables
+func CredentialConfigFromEnv() CredentialConfig {
+	return CredentialConfig{
+		AuthMethod:              os.Getenv("authMethod"),
+		TenantID:                os.Getenv("tenantId"),
+		ClientID:                os.Getenv("clientId"),
+		ClientSecret:            SecretFromEnv("clientSecret"),
+		CertificatePath:         os.Getenv("certificatePath"),
+		CertificatePassword:     SecretFromEnv("certificatePassword"),
+		FederatedTokenFile:      os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		ManagedIdentityEndpoint: os.Getenv("managedIdentityEndpoint"),
+		CredentialChain:         os.Getenv("credentialChain"),
+		Cloud:                   os.Getenv("cloud"),
+		AuthorityHost:           os.Getenv("authorityHost"),
+		ResourceManagerEndpoint: os.Getenv("resourceManagerEndpoint"),
+		TokenAudience:           os.Getenv("tokenAudience"),
+		ResourcesAPIVersion:     os.Getenv("resourcesApiVersion"),
+		MetricsAPIVersion:       os.Getenv("metricsApiVersion"),
+	}
+}
+
+var (
+	clientsMutex sync.Mutex
+	clients      = map[string]*Client{}
+)
+
+// GetAccessToken autentica o exporter na azure with the credential configured through
+// environment variables.
 func GetAccessToken() (Client, error) {
+	return GetClient("default", CredentialConfigFromEnv())
+}
+
+// GetClient returns the client of the credential profile name, created from config on first use.
+// Every profile keeps its own token, so tokens of different tenants are never mixed. Clients are
+// cached by name only: the configuration is read once at startup, so a later call with another
+// config for the same name still returns the first client.
+func GetClient(name string, config CredentialConfig) (Client, error) {
+	ac, err := cachedClient(name, config)
+	if err != nil {
+		return Client{}, err
+	}
+
+	// The token is requested outside the lock, so a slow identity provider of a profile does not
+	// block the scrapes of the other profiles
+	_, err = ac.getAccessToken()
+	if err != nil {
+		return Client{}, err
+	}
+
+	return *ac, nil
+}
+
+// cachedClient returns the cached client of the profile name, creating it when missing. The cloud
+// environment, which may be discovered over the network, is resolved without holding the lock.
+func cachedClient(name string, config CredentialConfig) (*Client, error) {
+	clientsMutex.Lock()
+	ac, ok := clients[name]
+	clientsMutex.Unlock()
+
+	if ok {
+		return ac, nil
+	}
+
+	environment, err := newEnvironment(config)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetClient] - Error in cloud configuration of credential %s", name), err)
+		return nil, err
+	}
+
+	credential, err := newCredential(config, environment)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetClient] - Error in configuration of credential %s", name), err)
+		return nil, err
+	}
+
+	client := newAzureClient(name, environment, credential)
+
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	// Another scrape may have created the client meanwhile, keep that one
+	if ac, ok := clients[name]; ok {
+		return ac, nil
+	}
+
+	clients[name] = &client
+	return &client, nil
+}
+
+// newCredential selects the credential according to the authMethod of the profile
+func newCredential(config CredentialConfig, environment Environment) (Credential, error) {
+	switch config.AuthMethod {
+	case "", "client_secret":
+		return &clientSecretCredential{
+			client:        &http.Client{},
+			authorityHost: environment.AuthorityHost,
+			tenantID:      config.TenantID,
+			clientID:      config.ClientID,
+			clientSecret:  config.ClientSecret,
+		}, nil
+	case "managed_identity":
+		return newManagedIdentityCredential(config.ClientID, config.ManagedIdentityEndpoint), nil
+	case "workload_identity":
+		return newWorkloadIdentityCredential(
+			environment.AuthorityHost,
+			firstNonEmpty(config.TenantID, os.Getenv("AZURE_TENANT_ID")),
+			firstNonEmpty(config.ClientID, os.Getenv("AZURE_CLIENT_ID")),
+			firstNonEmpty(config.FederatedTokenFile, os.Getenv("AZURE_FEDERATED_TOKEN_FILE")),
+		)
+	case "certificate":
+		return newCertificateCredential(
+			environment.AuthorityHost,
+			config.TenantID,
+			config.ClientID,
+			config.CertificatePath,
+			config.CertificatePassword,
+		)
+	case "chain":
+		return newChainedCredential(config, environment)
+	default:
+		return nil, fmt.Errorf("Unknown authMethod: %s", config.AuthMethod)
+	}
+}
 
-	ac := newAzureClient()
-	clientID := os.Getenv("clientId")
-	clientSecret := os.Getenv("clientSecret")
-	tenantID := os.Getenv("tenantId")
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// GetToken returns a valid token of the client credential for the audience. Tokens are cached
+// separately for every audience, so collectors of other Azure APIs can share the credential.
+func (ac *Client) GetToken(audience string) (Token, error) {
+	if ac.credential == nil {
+		return Token{}, fmt.Errorf("Client has no credential")
+	}
+
+	return getTokenProvider(ac.name, ac.credential, audience).Token()
+}
+
+// getAccessToken returns a valid token for Azure Resource Manager from the shared cache
+func (ac *Client) getAccessToken() (string, error) {
+	token, err := ac.GetToken(ac.environment.TokenAudience)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// clientSecretCredential authenticates a service principal with the client credentials flow
+type clientSecretCredential struct {
+	client        *http.Client
+	authorityHost string
+	tenantID      string
+	clientID      string
+	clientSecret  Secret
+}
+
+// GetToken requests a token for the audience using the service principal secret
+func (c *clientSecretCredential) GetToken(audience string) (Token, error) {
+
+	clientSecret, err := c.clientSecret.Value()
+	if err != nil {
+		logger.Error("[GetAccessToken] - Error reading client secret", err)
+		return Token{}, err
+	}
 
-	target := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/token", tenantID)
 	form := url.Values{
 		"grant_type":    {"client_credentials"},
-		"resource":      {"https://management.azure.com/"},
-		"client_id":     {clientID},
+		"client_id":     {c.clientID},
 		"client_secret": {clientSecret},
 	}
-	resp, err := ac.client.PostForm(target, form)
+
+	return requestToken(c.client, c.authorityHost, c.tenantID, audience, form)
+}
+
+// requestToken exchanges the form at the token endpoint of the tenant for a token of the audience.
+// Azure AD is asked through the v2.0 endpoint with the .default scope of the audience, while
+// AD FS, which only implements the v1 endpoint, is asked for the audience as resource.
+func requestToken(client *http.Client, authorityHost, tenantID, audience string, form url.Values) (Token, error) {
+
+	if isADFS(tenantID) {
+		form.Set("resource", audience)
+	} else {
+		form.Set("scope", audienceScope(audience))
+	}
+
+	token, err := postTokenForm(client, tokenEndpoint(authorityHost, tenantID), form)
 	if err != nil {
-		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), err)
-		return Client{}, fmt.Errorf("Error authenticating against Azure API: %v", err)
+		return Token{}, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), resp.StatusCode)
-		return Client{}, fmt.Errorf("Did not get status code 200, got: %d", resp.StatusCode)
+
+	if token.Resource == "" {
+		token.Resource = audience
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	return token, nil
+}
+
+// audienceScope returns the .default scope of the audience, unless it is already a scope
+func audienceScope(audience string) string {
+	if strings.HasSuffix(audience, "/.default") {
+		return audience
+	}
+	return strings.TrimSuffix(audience, "/") + "/.default"
+}
+
+// audienceResource returns the audience of a .default scope, as expected by v1 endpoints
+func audienceResource(audience string) string {
+	return strings.TrimSuffix(audience, "/.default")
+}
+
+func isADFS(tenantID string) bool {
+	return strings.EqualFold(tenantID, "adfs")
+}
+
+// postTokenForm exchanges the form at the token endpoint target
+func postTokenForm(client *http.Client, target string, form url.Values) (Token, error) {
+
+	resp, err := client.PostForm(target, form)
 	if err != nil {
 		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), err)
-		return Client{}, fmt.Errorf("Error reading body of response: %v", err)
+		return Token{}, fmt.Errorf("Error authenticating against Azure API: %v", err)
 	}
-	var data map[string]interface{}
-	err = json.Unmarshal(body, &data)
+
+	return readTokenResponse(resp, target)
+}
+
+// tokenEndpoint returns the OAuth token endpoint of the tenant at the authority host
+func tokenEndpoint(authorityHost, tenantID string) string {
+	if isADFS(tenantID) {
+		return fmt.Sprintf("%s%s/oauth2/token", withTrailingSlash(authorityHost), tenantID)
+	}
+	return fmt.Sprintf("%s%s/oauth2/v2.0/token", withTrailingSlash(authorityHost), tenantID)
+}
+
+// readTokenResponse decodes the token endpoint response, shared by every credential. Errors
+// returned by Azure AD and by malformed responses are reported as *AuthError.
+func readTokenResponse(resp *http.Response, target string) (Token, error) {
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), err)
-		return Client{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+		return Token{}, fmt.Errorf("Error reading body of response: %v", err)
 	}
-	ac.accessToken = data["access_token"].(string)
-	ac.resource = data["resource"].(string)
-	expiresOn, err := strconv.ParseInt(data["expires_on"].(string), 10, 64)
+
+	if resp.StatusCode != 200 {
+		authErr := newAuthError(resp, body)
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), authErr.Error())
+		return Token{}, authErr
+	}
+
+	var data TokenResponse
+	err = json.Unmarshal(body, &data)
 	if err != nil {
 		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), err)
-		return Client{}, fmt.Errorf("Error ParseInt of expires_on failed: %v", err)
+		return Token{}, invalidTokenResponse(resp, fmt.Sprintf("Error unmarshalling response body: %v", err))
 	}
-	ac.accessTokenExpiresOn = time.Unix(expiresOn, 0).UTC()
 
-	return ac, nil
-}
+	if data.AccessToken == "" {
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), "no access_token")
+		return Token{}, invalidTokenResponse(resp, "Response has no access_token")
+	}
 
-func (ac *Client) validateAccesssToken() error {
+	token := Token{
+		AccessToken: data.AccessToken,
+		Resource:    data.Resource,
+	}
 
-	now := time.Now().UTC()
-	refreshAt := ac.accessTokenExpiresOn.Add(-10 * time.Minute)
-	if now.After(refreshAt) {
-		newAc, err := GetAccessToken()
+	if data.ExpiresOn != "" {
+		expiresOn, err := data.ExpiresOn.Int64()
 		if err != nil {
-			//log.Fatal("Error refreshing access token: %v", err)
-			return err
+			logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), err)
+			return Token{}, invalidTokenResponse(resp, fmt.Sprintf("Error ParseInt of expires_on failed: %v", err))
 		}
+		token.ExpiresOn = time.Unix(expiresOn, 0).UTC()
+		return token, nil
+	}
 
-		ac.accessToken = newAc.accessToken
-		ac.resource = newAc.resource
-		ac.accessTokenExpiresOn = newAc.accessTokenExpiresOn
-
-		return nil
+	// the v2.0 endpoint only returns the lifetime of the token
+	expiresIn, err := data.ExpiresIn.Int64()
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", target), err)
+		return Token{}, invalidTokenResponse(resp, "Response has neither expires_on nor expires_in")
 	}
+	token.ExpiresOn = time.Now().UTC().Add(time.Duration(expiresIn) * time.Second)
 
-	return nil
+	return token, nil
 }
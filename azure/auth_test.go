@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientSecretCredentialRequestsScope(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.FormValue("scope") != "https://api.loganalytics.io/.default" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"ext_expires_in":3599,"access_token":"token"}`))
+	}))
+	defer server.Close()
+
+	credential := &clientSecretCredential{
+		client:        server.Client(),
+		authorityHost: server.URL,
+		tenantID:      "tenant",
+		clientID:      "client",
+		clientSecret:  NewSecret("secret"),
+	}
+
+	token, err := credential.GetToken("https://api.loganalytics.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "token" || token.Resource != "https://api.loganalytics.io" {
+		t.Errorf(errorMessageData, "token", token)
+	}
+
+	if token.ExpiresOn.Before(time.Now().Add(50 * time.Minute)) {
+		t.Errorf(errorMessageData, "one hour", token.ExpiresOn)
+	}
+}
+
+func TestAudienceScopeValidScenarios(t *testing.T) {
+
+	type testAudienceScope struct {
+		audience    string
+		expectative string
+	}
+	conditions := [4]testAudienceScope{
+		{"https://management.azure.com/", "https://management.azure.com/.default"},
+		{"https://vault.azure.net", "https://vault.azure.net/.default"},
+		{"https://graph.microsoft.com/.default", "https://graph.microsoft.com/.default"},
+		{"api://my-application", "api://my-application/.default"},
+	}
+
+	for _, condition := range conditions {
+
+		dataReturn := audienceScope(condition.audience)
+		if dataReturn != condition.expectative {
+			t.Errorf(errorMessageData, condition.expectative, dataReturn)
+		}
+	}
+}
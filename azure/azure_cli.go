@@ -0,0 +1,181 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const azureCLITimeLayout = "2006-01-02 15:04:05.999999"
+
+// azureCLITimeout bounds a run of "az account get-access-token"
+const azureCLITimeout = 30 * time.Second
+
+// azureCLICredential gets tokens from the Azure CLI signed in with "az login", running
+// "az account get-access-token". When the CLI cannot be run, the tokens cached in accessTokens.json
+// by Azure CLI versions before 2.30 are used, with their refresh token once they have expired.
+type azureCLICredential struct {
+	client *http.Client
+	path   string
+	run    func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+func newAzureCLICredential() (*azureCLICredential, error) {
+
+	credential := &azureCLICredential{client: &http.Client{}, run: runCommand}
+
+	directory := os.Getenv("AZURE_CONFIG_DIR")
+	if directory == "" {
+		if home := os.Getenv("HOME"); home != "" {
+			directory = filepath.Join(home, ".azure")
+		}
+	}
+
+	if directory != "" {
+		path := filepath.Join(directory, "accessTokens.json")
+		if _, err := os.Stat(path); err == nil {
+			credential.path = path
+		}
+	}
+
+	if _, err := exec.LookPath("az"); err != nil && credential.path == "" {
+		return nil, fmt.Errorf("Azure CLI not found in PATH and no Azure CLI token cache found")
+	}
+
+	return credential, nil
+}
+
+// runCommand runs the command, returning its standard error in the error when it fails
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	command := exec.CommandContext(ctx, name, args...)
+	command.Stderr = &stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
+
+// GetToken returns an Azure CLI token for the audience
+func (c *azureCLICredential) GetToken(audience string) (Token, error) {
+
+	resource := audienceResource(audience)
+
+	token, err := c.commandToken(resource)
+	if err == nil || c.path == "" {
+		return token, err
+	}
+
+	cached, cacheErr := c.cachedToken(resource)
+	if cacheErr != nil {
+		return Token{}, fmt.Errorf("%v, and from the token cache: %v", err, cacheErr)
+	}
+
+	return cached, nil
+}
+
+// commandToken gets the token for the resource from "az account get-access-token"
+func (c *azureCLICredential) commandToken(resource string) (Token, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), azureCLITimeout)
+	defer cancel()
+
+	output, err := c.run(ctx, "az", "account", "get-access-token", "--resource", resource, "-o", "json")
+	if err != nil {
+		return Token{}, fmt.Errorf("Error running az account get-access-token, run az login: %v", err)
+	}
+
+	var data AzureCLIAccessToken
+	err = json.Unmarshal(output, &data)
+	if err != nil {
+		return Token{}, fmt.Errorf("Error unmarshalling az account get-access-token output: %v", err)
+	}
+
+	if data.AccessToken == "" {
+		return Token{}, fmt.Errorf("No access token returned by az account get-access-token")
+	}
+
+	// expires_on is only returned by Azure CLI 2.54 and later, expiresOn is in local time
+	expiresOn, err := time.ParseInLocation(azureCLITimeLayout, data.ExpiresOn, time.Local)
+	if seconds, parseErr := strconv.ParseInt(data.ExpiresOnTimestamp.String(), 10, 64); parseErr == nil {
+		expiresOn, err = time.Unix(seconds, 0), nil
+	}
+	if err != nil {
+		return Token{}, fmt.Errorf("Error parsing Azure CLI token expiry %s: %v", data.ExpiresOn, err)
+	}
+
+	return Token{AccessToken: data.AccessToken, ExpiresOn: expiresOn.UTC(), Resource: resource}, nil
+}
+
+// cachedToken returns the token for the resource cached in accessTokens.json, refreshing it when expired
+func (c *azureCLICredential) cachedToken(resource string) (Token, error) {
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return Token{}, fmt.Errorf("Error reading Azure CLI token cache: %v", err)
+	}
+
+	var entries []AzureCLIToken
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return Token{}, fmt.Errorf("Error unmarshalling Azure CLI token cache: %v", err)
+	}
+
+	var refresh *AzureCLIToken
+	for index := range entries {
+		entry := &entries[index]
+
+		expiresOn, err := time.ParseInLocation(azureCLITimeLayout, entry.ExpiresOn, time.Local)
+		if err != nil {
+			continue
+		}
+
+		if sameResource(entry.Resource, resource) && time.Now().Before(expiresOn.Add(-tokenExpiryMargin)) {
+			return Token{AccessToken: entry.AccessToken, ExpiresOn: expiresOn.UTC(), Resource: resource}, nil
+		}
+
+		if entry.RefreshToken != "" && (refresh == nil || entry.ExpiresOn > refresh.ExpiresOn) {
+			refresh = entry
+		}
+	}
+
+	if refresh == nil {
+		return Token{}, fmt.Errorf("No Azure CLI token found for %s, run az login", resource)
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {refresh.ClientID},
+		"refresh_token": {refresh.RefreshToken},
+		"resource":      {resource},
+	}
+
+	return postTokenForm(c.client, strings.TrimSuffix(refresh.Authority, "/")+"/oauth2/token", form)
+}
+
+// sameResource compares resources ignoring the trailing slash and the legacy
+// management.core.windows.net alias that the Azure CLI uses for Azure Resource Manager
+func sameResource(a, b string) bool {
+	normalize := func(resource string) string {
+		resource = strings.TrimSuffix(strings.ToLower(resource), "/")
+		if resource == "https://management.core.windows.net" {
+			return "https://management.azure.com"
+		}
+		return resource
+	}
+
+	return normalize(a) == normalize(b)
+}
@@ -0,0 +1,73 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAzureCLICredentialCommand(t *testing.T) {
+
+	var args []string
+	credential := &azureCLICredential{run: func(ctx context.Context, name string, arguments ...string) ([]byte, error) {
+		args = append([]string{name}, arguments...)
+		return []byte(`{"accessToken":"token","expiresOn":"2030-01-02 03:04:05.000000","expires_on":1893553445,"tenant":"tenant","tokenType":"Bearer"}`), nil
+	}}
+
+	token, err := credential.GetToken("https://management.azure.com/.default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command := "az account get-access-token --resource https://management.azure.com -o json"
+	if strings.Join(args, " ") != command {
+		t.Errorf(errorMessageData, command, strings.Join(args, " "))
+	}
+
+	if token.AccessToken != "token" || !token.ExpiresOn.Equal(time.Unix(1893553445, 0)) {
+		t.Errorf(errorMessageData, "token", fmt.Sprint(token))
+	}
+
+	credential.run = func(ctx context.Context, name string, arguments ...string) ([]byte, error) {
+		return []byte(`{"accessToken":"token","expiresOn":"2030-01-02 03:04:05.000000"}`), nil
+	}
+
+	token, err = credential.GetToken("https://management.azure.com/.default")
+	expiresOn := time.Date(2030, 1, 2, 3, 4, 5, 0, time.Local)
+	if err != nil || !token.ExpiresOn.Equal(expiresOn) {
+		t.Errorf(errorMessageData, expiresOn.String(), fmt.Sprint(token, err))
+	}
+}
+
+func TestAzureCLICredentialTokenCacheFallback(t *testing.T) {
+
+	file, err := ioutil.TempFile("", "accessTokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	expiresOn := time.Now().Add(time.Hour).Format(azureCLITimeLayout)
+	fmt.Fprintf(file, `[{"tokenType":"Bearer","expiresOn":"%s","resource":"https://management.core.windows.net/","accessToken":"cached"}]`, expiresOn)
+	file.Close()
+
+	failing := func(ctx context.Context, name string, arguments ...string) ([]byte, error) {
+		return nil, fmt.Errorf("exit status 1: Please run 'az login' to setup account.")
+	}
+
+	credential := &azureCLICredential{path: file.Name(), run: failing}
+
+	token, err := credential.GetToken("https://management.azure.com/.default")
+	if err != nil || token.AccessToken != "cached" {
+		t.Errorf(errorMessageData, "cached", fmt.Sprint(token, err))
+	}
+
+	credential.path = ""
+	if _, err := credential.GetToken("https://management.azure.com/.default"); err == nil || !strings.Contains(err.Error(), "az login") {
+		t.Errorf(errorMessageData, "az login", fmt.Sprint(err))
+	}
+}
@@ -0,0 +1,263 @@
+package azure
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// certificateCredential authenticates a service principal with a signed JWT client assertion
+// instead of a client secret. The certificate is loaded again whenever its file changes.
+type certificateCredential struct {
+	client        *http.Client
+	authorityHost string
+	tenantID      string
+	clientID      string
+	path          string
+	password      Secret
+
+	mutex       sync.Mutex
+	modTime     time.Time
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+func newCertificateCredential(authorityHost, tenantID, clientID, path string, password Secret) (*certificateCredential, error) {
+	if tenantID == "" || clientID == "" || path == "" {
+		return nil, fmt.Errorf("Certificate authentication requires tenantId, clientId and certificatePath")
+	}
+
+	credential := &certificateCredential{
+		client:        &http.Client{},
+		authorityHost: authorityHost,
+		tenantID:      tenantID,
+		clientID:      clientID,
+		path:          path,
+		password:      password,
+	}
+
+	_, _, err := credential.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// GetToken requests a token for the audience using a client assertion signed by the certificate
+func (c *certificateCredential) GetToken(audience string) (Token, error) {
+
+	assertion, err := c.clientAssertion(tokenEndpoint(c.authorityHost, c.tenantID))
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error signing client assertion with %s", c.path), err)
+		return Token{}, err
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {c.clientID},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}
+
+	return requestToken(c.client, c.authorityHost, c.tenantID, audience, form)
+}
+
+// clientAssertion builds the JWT expected by Azure AD, identifying the certificate by its thumbprint
+func (c *certificateCredential) clientAssertion(audience string) (string, error) {
+
+	certificate, key, err := c.load()
+	if err != nil {
+		return "", err
+	}
+
+	thumbprint := sha1.Sum(certificate.Raw)
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("Error generating assertion id: %v", err)
+	}
+
+	now := time.Now().UTC()
+	claims := map[string]interface{}{
+		"aud": audience,
+		"iss": c.clientID,
+		"sub": c.clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	}
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling assertion header: %v", err)
+	}
+	encodedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling assertion claims: %v", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(encodedClaims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("Error signing client assertion: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// load returns the certificate and private key, reading the file again when it has been modified
+func (c *certificateCredential) load() (*x509.Certificate, *rsa.PrivateKey, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading certificate file: %v", err)
+	}
+
+	if c.certificate != nil && info.ModTime().Equal(c.modTime) {
+		return c.certificate, c.key, nil
+	}
+
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading certificate file: %v", err)
+	}
+
+	password, err := c.password.Value()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificate, key, err := parseCertificate(content, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing certificate %s: %v", c.path, err)
+	}
+
+	c.certificate = certificate
+	c.key = key
+	c.modTime = info.ModTime()
+
+	return c.certificate, c.key, nil
+}
+
+// parseCertificate decodes a PEM bundle or a PKCS#12 archive holding the certificate and its RSA private key
+func parseCertificate(content []byte, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+
+	var blocks []*pem.Block
+	if strings.Contains(string(content), "-----BEGIN") {
+		for rest := content; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+	} else {
+		var err error
+		blocks, err = pkcs12.ToPEM(content, password)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var certificates []*x509.Certificate
+	var key *rsa.PrivateKey
+
+	for _, block := range blocks {
+		switch {
+		case block.Type == "CERTIFICATE":
+			parsed, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certificates = append(certificates, parsed)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY") && key == nil:
+			parsed, err := parsePrivateKey(block, password)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = parsed
+		}
+	}
+
+	if len(certificates) == 0 {
+		return nil, nil, fmt.Errorf("No certificate found")
+	}
+
+	if key == nil {
+		return nil, nil, fmt.Errorf("No private key found")
+	}
+
+	// Chains also hold the intermediate and CA certificates, the signing certificate is the one
+	// of the private key
+	for _, certificate := range certificates {
+		if publicKey, ok := certificate.PublicKey.(*rsa.PublicKey); ok && publicKey.N.Cmp(key.N) == 0 && publicKey.E == key.E {
+			return certificate, key, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("No certificate matches the private key")
+}
+
+func parsePrivateKey(block *pem.Block, password string) (*rsa.PrivateKey, error) {
+	der := block.Bytes
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		decrypted, err := decryptPKCS8(der, password)
+		if err != nil {
+			return nil, err
+		}
+		der = decrypted
+	case block.Headers["Proc-Type"] == "4,ENCRYPTED":
+		// Legacy OpenSSL encryption, deprecated as insecure but still written by older tools
+		decrypted, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+		der = decrypted
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Private key is not a RSA key")
+	}
+
+	return key, nil
+}
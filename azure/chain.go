@@ -0,0 +1,111 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const defaultCredentialChain = "environment,workload_identity,managed_identity,azure_cli"
+
+// managed identity endpoints are probed with a short timeout, as they do not answer outside Azure
+const managedIdentityProbeTimeout = 3 * time.Second
+
+// chainedCredential tries several credential sources in order and keeps using the first one
+// that returns a token, like DefaultAzureCredential of the Azure SDKs.
+type chainedCredential struct {
+	config      CredentialConfig
+	environment Environment
+	sources     []string
+
+	mutex    sync.Mutex
+	selected Credential
+}
+
+func newChainedCredential(config CredentialConfig, environment Environment) (*chainedCredential, error) {
+
+	chain := config.CredentialChain
+	if chain == "" {
+		chain = defaultCredentialChain
+	}
+
+	sources := []string{}
+	for _, source := range strings.Split(chain, ",") {
+		source = strings.TrimSpace(source)
+		switch source {
+		case "":
+			continue
+		case "environment", "workload_identity", "managed_identity", "azure_cli":
+			sources = append(sources, source)
+		default:
+			return nil, fmt.Errorf("Unknown credential source in credentialChain: %s", source)
+		}
+	}
+
+	return &chainedCredential{config: config, environment: environment, sources: sources}, nil
+}
+
+// GetToken requests the token from the selected source, selecting it on first use
+func (c *chainedCredential) GetToken(audience string) (Token, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.selected != nil {
+		return c.selected.GetToken(audience)
+	}
+
+	skipped := []string{}
+	for _, source := range c.sources {
+
+		credential, err := c.newSource(source)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+
+		token, err := credential.GetToken(audience)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+
+		c.selected = credential
+		logger.Info(fmt.Sprintf("[GetAccessToken] - Credential chain authenticated with %s, skipped [ %s ]", source, strings.Join(skipped, "; ")))
+
+		return token, nil
+	}
+
+	return Token{}, fmt.Errorf("No credential in the chain succeeded: %s", strings.Join(skipped, "; "))
+}
+
+// newSource creates the credential of the source, failing when it is not configured
+func (c *chainedCredential) newSource(source string) (Credential, error) {
+	config := c.config
+
+	switch source {
+	case "environment":
+		if config.TenantID == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("tenantId or clientId is not set")
+		}
+		if config.CertificatePath != "" {
+			config.AuthMethod = "certificate"
+		} else if !config.ClientSecret.IsEmpty() {
+			config.AuthMethod = "client_secret"
+		} else {
+			return nil, fmt.Errorf("neither clientSecret nor certificatePath is set")
+		}
+		return newCredential(config, c.environment)
+	case "workload_identity":
+		config.AuthMethod = source
+		return newCredential(config, c.environment)
+	case "managed_identity":
+		credential := newManagedIdentityCredential(config.ClientID, config.ManagedIdentityEndpoint)
+		credential.client.Timeout = managedIdentityProbeTimeout
+		return credential, nil
+	default:
+		return newAzureCLICredential()
+	}
+}
@@ -0,0 +1,82 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainedCredentialSkipsUnavailableSources(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"token","expires_on":"1546300800","resource":"` + r.URL.Query().Get("resource") + `"}`))
+	}))
+	defer server.Close()
+
+	config := CredentialConfig{
+		AuthMethod:              "chain",
+		CredentialChain:         "environment,managed_identity",
+		ManagedIdentityEndpoint: server.URL,
+	}
+
+	credential, err := newCredential(config, PublicCloud)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := credential.GetToken(PublicCloud.TokenAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "token" {
+		t.Errorf(errorMessageData, "token", token.AccessToken)
+	}
+
+	if _, ok := credential.(*chainedCredential).selected.(*managedIdentityCredential); !ok {
+		t.Errorf(errorMessageData, "managed_identity", credential.(*chainedCredential).selected)
+	}
+}
+
+func TestChainedCredentialReportsSkippedSources(t *testing.T) {
+
+	config := CredentialConfig{
+		AuthMethod:      "chain",
+		CredentialChain: "environment,workload_identity",
+	}
+
+	credential, err := newCredential(config, PublicCloud)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = credential.GetToken(PublicCloud.TokenAudience)
+	if err == nil || !strings.Contains(err.Error(), "environment:") || !strings.Contains(err.Error(), "workload_identity:") {
+		t.Errorf(errorMessageData, "environment and workload_identity skipped", err)
+	}
+}
+
+func TestSameResourceValidScenarios(t *testing.T) {
+
+	type testSameResource struct {
+		a           string
+		b           string
+		expectative bool
+	}
+	conditions := [4]testSameResource{
+		{"https://management.azure.com/", "https://management.azure.com", true},
+		{"https://management.core.windows.net/", "https://management.azure.com/", true},
+		{"https://vault.azure.net", "https://management.azure.com/", false},
+		{"", "https://management.azure.com/", false},
+	}
+
+	for _, condition := range conditions {
+
+		dataReturn := sameResource(condition.a, condition.b)
+		if dataReturn != condition.expectative {
+			t.Errorf(errorMessageData, fmt.Sprint(condition.expectative), fmt.Sprint(dataReturn))
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+// childAPIVersions are the API versions of the child resource lists known to the exporter
+var childAPIVersions = map[string]string{
+	"microsoft.sql/servers/databases":                           "2021-11-01",
+	"microsoft.sql/servers/elasticpools":                        "2021-11-01",
+	"microsoft.web/sites/slots":                                 "2022-03-01",
+	"microsoft.storage/storageaccounts/blobservices":            "2022-09-01",
+	"microsoft.storage/storageaccounts/fileservices":            "2022-09-01",
+	"microsoft.storage/storageaccounts/queueservices":           "2022-09-01",
+	"microsoft.storage/storageaccounts/tableservices":           "2022-09-01",
+	"microsoft.compute/virtualmachinescalesets/virtualmachines": "2022-08-01",
+}
+
+// ChildResourceType is a type of nested resource, like Microsoft.Sql/servers/databases, that the
+// subscription resource list does not return and that is listed below each parent resource
+type ChildResourceType struct {
+	Type       string `yaml:"type"`
+	APIVersion string `yaml:"apiVersion"`
+}
+
+// Complete checks the child type and sets the API version of the known types when it is empty
+func (c *ChildResourceType) Complete() error {
+
+	if strings.Count(c.Type, "/") < 2 {
+		return fmt.Errorf("Child resource type %s is not nested below a parent type", c.Type)
+	}
+
+	if c.APIVersion == "" {
+		c.APIVersion = childAPIVersions[strings.ToLower(c.Type)]
+	}
+
+	if c.APIVersion == "" {
+		return fmt.Errorf("Child resource type %s has no apiVersion", c.Type)
+	}
+
+	return nil
+}
+
+// ParentType returns the type of the parent resources, like Microsoft.Sql/servers
+func (c *ChildResourceType) ParentType() string {
+	return c.Type[:strings.LastIndex(c.Type, "/")]
+}
+
+// GetChildResources lists the children of the parent resource. Children inherit the tags of the
+// parent they do not set themselves, so they are selected and labelled like their parent.
+func (ac *Client) GetChildResources(parent Resource, child ChildResourceType) ([]Resource, error) {
+
+	childTarget := fmt.Sprintf("%s%s/%s", strings.TrimSuffix(ac.environment.ResourceManagerEndpoint, "/"), parent.ID, child.Type[strings.LastIndex(child.Type, "/")+1:])
+
+	values := url.Values{}
+	values.Add("api-version", child.APIVersion)
+
+	children := []Resource{}
+	err := ac.getPages("childResources", childTarget, values, func(body []byte) (string, error) {
+		var page ResourceResponse
+		err := json.Unmarshal(body, &page)
+		children = append(children, page.Value...)
+		return page.NextLink, err
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetChildResources] - Error listing %s of %s", child.Type, parent.ID), err)
+		return nil, err
+	}
+
+	for index := range children {
+		resource := &children[index]
+
+		resource.Parent = parent.Name
+		if resource.Type == "" {
+			resource.Type = child.Type
+		}
+		if resource.Location == "" {
+			resource.Location = parent.Location
+		}
+
+		tags := make(map[string]string)
+		for name, value := range parent.Tags {
+			tags[name] = value
+		}
+		for name, value := range resource.Tags {
+			tags[name] = value
+		}
+		resource.Tags = tags
+	}
+
+	return children, nil
+}
+
+// ParentFilters returns the conditions of the filters that children share with their parent: the
+// tags, which children inherit, and the resource group. Resources are listed with them so that the
+// parents are expanded even when only their children match the other conditions.
+func ParentFilters(filters []ResourceFilter) []ResourceFilter {
+	parents := []ResourceFilter{}
+
+	for _, filter := range filters {
+		parents = append(parents, ResourceFilter{
+			Tags:                  filter.Tags,
+			AnyTags:               filter.AnyTags,
+			ResourceGroups:        filter.ResourceGroups,
+			ExcludeResourceGroups: filter.ExcludeResourceGroups,
+		})
+	}
+
+	return parents
+}
+
+// ExpandChildResources appends the children of the child types to the resources, and returns the
+// resources and children matching every filter. A parent whose children cannot be listed is
+// logged and skipped.
+func (ac *Client) ExpandChildResources(resources []Resource, childTypes []ChildResourceType, filters ...ResourceFilter) []Resource {
+
+	expanded := append([]Resource{}, resources...)
+	for _, parent := range resources {
+		for _, child := range childTypes {
+			if !strings.EqualFold(parent.Type, child.ParentType()) {
+				continue
+			}
+
+			children, err := ac.GetChildResources(parent, child)
+			if err != nil {
+				continue
+			}
+			expanded = append(expanded, children...)
+		}
+	}
+
+	return FilterResources(expanded, filters...)
+}
@@ -0,0 +1,114 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpandChildResources(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Sql/servers/sql/databases":
+			if r.URL.Query().Get("api-version") != "2021-11-01" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"value":[{"id":"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Sql/servers/sql/databases/orders","name":"orders","type":"Microsoft.Sql/servers/databases","location":"brazilsouth","tags":{"owner":"dba"}}]}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("children", environment, &countingCredential{})
+
+	childTypes := []ChildResourceType{{Type: "Microsoft.Sql/servers/databases"}, {Type: "Microsoft.Web/sites/slots"}}
+	for index := range childTypes {
+		if err := childTypes[index].Complete(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resources := []Resource{
+		{ID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Sql/servers/sql", Name: "sql", Type: "microsoft.sql/servers", Tags: map[string]string{"team": "payments", "owner": "platform"}},
+		{ID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Web/sites/site", Name: "site", Type: "Microsoft.Web/sites"},
+	}
+
+	expanded := ac.ExpandChildResources(resources, childTypes)
+
+	if len(expanded) != 3 {
+		t.Fatalf(errorMessageQuantity, "3", fmt.Sprint(len(expanded)))
+	}
+
+	child := expanded[2]
+	if child.Parent != "sql" || child.Tags["team"] != "payments" || child.Tags["owner"] != "dba" {
+		t.Errorf(errorMessageData, "orders", fmt.Sprint(child))
+	}
+}
+
+func TestExpandChildResourcesFilters(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value":[
+			{"id":"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Sql/servers/sql/databases/orders","name":"orders","type":"Microsoft.Sql/servers/databases"},
+			{"id":"/subscriptions/s/resourceGroups/rg/providers/Microsoft.Sql/servers/sql/databases/master","name":"master","type":"Microsoft.Sql/servers/databases","location":"westus"}
+		]}`)
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("children-filters", environment, &countingCredential{})
+
+	childTypes := []ChildResourceType{{Type: "Microsoft.Sql/servers/databases", APIVersion: "2021-11-01"}}
+	parent := Resource{ID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Sql/servers/sql", Name: "sql", Type: "Microsoft.Sql/servers", Location: "brazilsouth", Tags: map[string]string{"team": "payments"}}
+
+	conditions := []struct {
+		filter      ResourceFilter
+		expectative string
+	}{
+		{ResourceFilter{ResourceTypes: []string{"Microsoft.Sql/servers/databases"}}, "orders,master"},
+		{ResourceFilter{ExcludeResourceTypes: []string{"Microsoft.Sql/servers/databases"}}, "sql"},
+		{ResourceFilter{Names: []string{"orders"}}, "orders"},
+		{ResourceFilter{Locations: []string{"brazilsouth"}}, "sql,orders"},
+		{ResourceFilter{Tags: []string{"team=payments"}, ExcludeResourceTypes: []string{"Microsoft.Sql/servers"}}, "orders,master"},
+	}
+
+	for _, condition := range conditions {
+		listed := FilterResources([]Resource{parent}, ParentFilters([]ResourceFilter{condition.filter})...)
+
+		names := []string{}
+		for _, resource := range ac.ExpandChildResources(listed, childTypes, condition.filter) {
+			names = append(names, resource.Name)
+		}
+
+		if strings.Join(names, ",") != condition.expectative {
+			t.Errorf(errorMessageData, condition.expectative, strings.Join(names, ","))
+		}
+	}
+}
+
+func TestChildResourceTypeComplete(t *testing.T) {
+
+	conditions := []ChildResourceType{
+		{Type: "Microsoft.Sql/servers"},
+		{Type: "Microsoft.Custom/parents/children"},
+	}
+
+	for _, condition := range conditions {
+		if err := condition.Complete(); err == nil {
+			t.Errorf(errorMessageData, "error", condition.Type)
+		}
+	}
+
+	child := ChildResourceType{Type: "Microsoft.Custom/parents/children", APIVersion: "2020-01-01"}
+	if err := child.Complete(); err != nil || child.ParentType() != "Microsoft.Custom/parents" {
+		t.Errorf(errorMessageData, "Microsoft.Custom/parents", child.ParentType())
+	}
+}
@@ -0,0 +1,69 @@
+package azure
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MetricDimension splits a metric by its dimensions. Filter is the $filter of Azure Monitor on
+// the dimensions, like "EntityName eq '*'" for every entity or "ApiName eq 'GetBlob' or ApiName eq
+// 'PutBlob'" for some values, and Top the maximum number of timeseries returned (10 by default).
+type MetricDimension struct {
+	ResourceType string `yaml:"resourceType"`
+	Metric       string `yaml:"metric"`
+	Filter       string `yaml:"filter"`
+	Top          int    `yaml:"top"`
+}
+
+var (
+	invalidDimensionChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+	dimensionWordBoundary = regexp.MustCompile("([a-z0-9])([A-Z])")
+	dimensionFilterName   = regexp.MustCompile(`(?i)([a-z0-9_.]+)\s+eq\s+'`)
+)
+
+// Matches checks if the dimensions apply to the metric of the resource type, any resource type
+// when ResourceType is empty
+func (d *MetricDimension) Matches(resourceType, metric string) bool {
+	return strings.EqualFold(d.Metric, metric) && (d.ResourceType == "" || strings.EqualFold(d.ResourceType, resourceType))
+}
+
+// DimensionNames returns the dimensions named in the $filter of a query, in their first order,
+// like EntityName and OperationResult for "EntityName eq '*' and OperationResult eq 'Success'"
+func DimensionNames(filter string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+
+	for _, match := range dimensionFilterName.FindAllStringSubmatch(filter, -1) {
+		if seen[strings.ToLower(match[1])] {
+			continue
+		}
+		seen[strings.ToLower(match[1])] = true
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// DimensionLabels returns the labels of the dimensions named in the filter of the query. Every
+// timeseries gets the same labels, empty when it lacks a dimension, whatever Azure returns.
+func (timeseries MetricTimeseries) DimensionLabels(names []string) map[string]string {
+	labels := make(map[string]string)
+
+	for _, name := range names {
+		labels[DimensionLabelName(name)] = ""
+		for _, metadata := range timeseries.MetadataValues {
+			if strings.EqualFold(metadata.Name.Value, name) {
+				labels[DimensionLabelName(name)] = metadata.Value
+			}
+		}
+	}
+
+	return labels
+}
+
+// DimensionLabelName returns the label of the dimension, in snake case and prefixed with
+// dimension_ so it cannot override the labels of the exporter, like dimension_entity_name
+func DimensionLabelName(name string) string {
+	name = dimensionWordBoundary.ReplaceAllString(name, "${1}_${2}")
+	return "dimension_" + strings.ToLower(invalidDimensionChars.ReplaceAllString(name, "_"))
+}
@@ -0,0 +1,124 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDimensionLabelName(t *testing.T) {
+
+	conditions := map[string]string{
+		"EntityName":      "dimension_entity_name",
+		"ApiName":         "dimension_api_name",
+		"StatusCode":      "dimension_status_code",
+		"Instance":        "dimension_instance",
+		"GeoType":         "dimension_geo_type",
+		"http.status-2xx": "dimension_http_status_2xx",
+	}
+
+	for name, expected := range conditions {
+		if label := DimensionLabelName(name); label != expected {
+			t.Errorf(errorMessageData, expected, label)
+		}
+	}
+}
+
+func TestDimensionNames(t *testing.T) {
+
+	conditions := map[string]string{
+		"EntityName eq '*'":                                  "EntityName",
+		"ApiName eq 'GetBlob' or ApiName eq 'PutBlob'":       "ApiName",
+		"EntityName eq '*' and OperationResult eq 'Success'": "EntityName,OperationResult",
+		"": "",
+		"EntityName EQ 'orders' or entityname eq 'payments'": "EntityName",
+	}
+
+	for filter, expected := range conditions {
+		if names := strings.Join(DimensionNames(filter), ","); names != expected {
+			t.Errorf(errorMessageData, expected, names)
+		}
+	}
+}
+
+func TestDimensionLabels(t *testing.T) {
+
+	var value MetricValueResponseValue
+	err := json.Unmarshal([]byte(`{"timeseries":[
+		{"metadatavalues":[{"name":{"value":"EntityName"},"value":"orders"}],"data":[{"total":1}]},
+		{"metadatavalues":[{"name":{"value":"entityname"},"value":"payments"},{"name":{"value":"OperationResult"},"value":"Success"}],"data":[{"total":2}]}
+	]}`), &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"EntityName", "OperationResult"}
+
+	labels := value.Timeseries[0].DimensionLabels(names)
+	if len(labels) != 2 || labels["dimension_entity_name"] != "orders" || labels["dimension_operation_result"] != "" {
+		t.Errorf(errorMessageData, "orders", labels)
+	}
+
+	labels = value.Timeseries[1].DimensionLabels(names)
+	if labels["dimension_entity_name"] != "payments" || labels["dimension_operation_result"] != "Success" {
+		t.Errorf(errorMessageData, "payments", labels)
+	}
+
+	// Dimensions missing from the filter are left out, so the label set only depends on the configuration
+	labels = value.Timeseries[1].DimensionLabels([]string{"EntityName"})
+	if len(labels) != 1 {
+		t.Errorf(errorMessageQuantity, "1", fmt.Sprint(len(labels)))
+	}
+}
+
+func TestMetricDimensionMatches(t *testing.T) {
+
+	dimension := MetricDimension{ResourceType: "Microsoft.ServiceBus/namespaces", Metric: "IncomingMessages"}
+
+	if !dimension.Matches("microsoft.servicebus/namespaces", "incomingmessages") {
+		t.Errorf(errorMessageData, "true", fmt.Sprint(dimension))
+	}
+
+	if dimension.Matches("Microsoft.EventHub/namespaces", "IncomingMessages") {
+		t.Errorf(errorMessageData, "false", fmt.Sprint(dimension))
+	}
+
+	dimension.ResourceType = ""
+	if !dimension.Matches("Microsoft.EventHub/namespaces", "IncomingMessages") {
+		t.Errorf(errorMessageData, "true", fmt.Sprint(dimension))
+	}
+}
+
+func TestGetMetricSendsDimensionFilter(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("$filter") != "EntityName eq '*'" || query.Get("top") != "50" || query.Get("metricnames") != "IncomingMessages" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"value":[{"name":{"value":"IncomingMessages"},"timeseries":[{"metadatavalues":[{"name":{"value":"EntityName"},"value":"orders"}],"data":[{"total":3}]}]}]}`)
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL
+	ac := newAzureClient("dimensions", environment, &countingCredential{})
+
+	data, err := ac.GetMetric("/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/bus", MetricQuery{MetricNames: "IncomingMessages", Aggregation: "Total", Filter: "EntityName eq '*'", Top: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Value[0].Timeseries[0].MetadataValues[0].Value != "orders" {
+		t.Errorf(errorMessageData, "orders", data.Value[0].Timeseries[0].MetadataValues)
+	}
+
+	_, err = ac.GetMetric("/subscriptions/s/resourceGroups/rg/providers/Microsoft.ServiceBus/namespaces/bus", MetricQuery{MetricNames: "IncomingMessages,OutgoingMessages", Filter: "EntityName eq '*'"})
+	if err == nil {
+		t.Errorf(errorMessageData, "error", "several metric names")
+	}
+}
@@ -0,0 +1,185 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const (
+	defaultResourcesAPIVersion = "2018-05-01"
+	defaultMetricsAPIVersion   = "2018-01-01"
+	metadataAPIVersion         = "2015-01-01"
+)
+
+// Environment represents the endpoints of an Azure cloud
+type Environment struct {
+	Name                    string
+	AuthorityHost           string
+	ResourceManagerEndpoint string
+	TokenAudience           string
+	ResourcesAPIVersion     string
+	MetricsAPIVersion       string
+}
+
+// PublicCloud is the global Azure cloud
+var PublicCloud = Environment{
+	Name:                    "public",
+	AuthorityHost:           "https://login.microsoftonline.com/",
+	ResourceManagerEndpoint: "https://management.azure.com/",
+	TokenAudience:           "https://management.azure.com/",
+	ResourcesAPIVersion:     defaultResourcesAPIVersion,
+	MetricsAPIVersion:       defaultMetricsAPIVersion,
+}
+
+// ChinaCloud is Azure China operated by 21Vianet
+var ChinaCloud = Environment{
+	Name:                    "china",
+	AuthorityHost:           "https://login.chinacloudapi.cn/",
+	ResourceManagerEndpoint: "https://management.chinacloudapi.cn/",
+	TokenAudience:           "https://management.chinacloudapi.cn/",
+	ResourcesAPIVersion:     defaultResourcesAPIVersion,
+	MetricsAPIVersion:       defaultMetricsAPIVersion,
+}
+
+// USGovernmentCloud is Azure US Government
+var USGovernmentCloud = Environment{
+	Name:                    "usgov",
+	AuthorityHost:           "https://login.microsoftonline.us/",
+	ResourceManagerEndpoint: "https://management.usgovcloudapi.net/",
+	TokenAudience:           "https://management.usgovcloudapi.net/",
+	ResourcesAPIVersion:     defaultResourcesAPIVersion,
+	MetricsAPIVersion:       defaultMetricsAPIVersion,
+}
+
+var environments = map[string]Environment{
+	PublicCloud.Name:       PublicCloud,
+	ChinaCloud.Name:        ChinaCloud,
+	USGovernmentCloud.Name: USGovernmentCloud,
+}
+
+// GetEnvironment returns the cloud by name. The custom cloud takes its endpoints from
+// authorityHost, resourceManagerEndpoint and tokenAudience instead, and the azurestack
+// cloud discovers them from the metadata of resourceManagerEndpoint.
+func GetEnvironment(name, authorityHost, resourceManagerEndpoint, tokenAudience string) (Environment, error) {
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = PublicCloud.Name
+	}
+
+	if name == "azurestack" {
+		if resourceManagerEndpoint == "" {
+			return Environment{}, fmt.Errorf("Azure Stack cloud requires resourceManagerEndpoint")
+		}
+		return DiscoverEnvironment(&http.Client{}, resourceManagerEndpoint)
+	}
+
+	if name != "custom" {
+		environment, ok := environments[name]
+		if !ok {
+			return Environment{}, fmt.Errorf("Unknown cloud: %s", name)
+		}
+		return environment, nil
+	}
+
+	if authorityHost == "" || resourceManagerEndpoint == "" {
+		return Environment{}, fmt.Errorf("Custom cloud requires authorityHost and resourceManagerEndpoint")
+	}
+
+	if tokenAudience == "" {
+		tokenAudience = resourceManagerEndpoint
+	}
+
+	return Environment{
+		Name:                    name,
+		AuthorityHost:           withTrailingSlash(authorityHost),
+		ResourceManagerEndpoint: withTrailingSlash(resourceManagerEndpoint),
+		TokenAudience:           tokenAudience,
+		ResourcesAPIVersion:     defaultResourcesAPIVersion,
+		MetricsAPIVersion:       defaultMetricsAPIVersion,
+	}, nil
+}
+
+// DiscoverEnvironment builds the cloud of an Azure Stack Hub installation, reading the login
+// endpoint and token audience from the metadata endpoint of its Azure Resource Manager.
+func DiscoverEnvironment(client *http.Client, resourceManagerEndpoint string) (Environment, error) {
+
+	resourceManagerEndpoint = withTrailingSlash(resourceManagerEndpoint)
+	target := fmt.Sprintf("%smetadata/endpoints?api-version=%s", resourceManagerEndpoint, metadataAPIVersion)
+
+	resp, err := client.Get(target)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[DiscoverEnvironment] - Error in GET %s", target), err)
+		return Environment{}, fmt.Errorf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		logger.Error(fmt.Sprintf("[DiscoverEnvironment] - Error in GET %s", target), resp.StatusCode)
+		return Environment{}, fmt.Errorf("Unable to query metadata endpoints with status code: %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[DiscoverEnvironment] - Error in GET %s", target), err)
+		return Environment{}, fmt.Errorf("Error reading body of response: %v", err)
+	}
+
+	var data MetadataEndpointsResponse
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[DiscoverEnvironment] - Error in GET %s", target), err)
+		return Environment{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+	}
+
+	if data.Authentication.LoginEndpoint == "" || len(data.Authentication.Audiences) == 0 {
+		return Environment{}, fmt.Errorf("Metadata endpoints of %s have no authentication endpoint", resourceManagerEndpoint)
+	}
+
+	// AD FS installations use "adfs" in place of the tenant, so the authority host is the one before it
+	authorityHost := withTrailingSlash(data.Authentication.LoginEndpoint)
+	authorityHost = strings.TrimSuffix(authorityHost, "adfs/")
+
+	return Environment{
+		Name:                    "azurestack",
+		AuthorityHost:           authorityHost,
+		ResourceManagerEndpoint: resourceManagerEndpoint,
+		TokenAudience:           data.Authentication.Audiences[0],
+		ResourcesAPIVersion:     defaultResourcesAPIVersion,
+		MetricsAPIVersion:       defaultMetricsAPIVersion,
+	}, nil
+}
+
+// newEnvironment selects the cloud of a credential profile, applying its API versions
+func newEnvironment(config CredentialConfig) (Environment, error) {
+	environment, err := GetEnvironment(
+		config.Cloud,
+		config.AuthorityHost,
+		config.ResourceManagerEndpoint,
+		config.TokenAudience,
+	)
+	if err != nil {
+		return Environment{}, err
+	}
+
+	if config.ResourcesAPIVersion != "" {
+		environment.ResourcesAPIVersion = config.ResourcesAPIVersion
+	}
+
+	if config.MetricsAPIVersion != "" {
+		environment.MetricsAPIVersion = config.MetricsAPIVersion
+	}
+
+	return environment, nil
+}
+
+func withTrailingSlash(endpoint string) string {
+	if strings.HasSuffix(endpoint, "/") {
+		return endpoint
+	}
+	return endpoint + "/"
+}
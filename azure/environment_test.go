@@ -0,0 +1,84 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetEnvironmentValidScenarios(t *testing.T) {
+
+	type testGetEnvironment struct {
+		name                    string
+		authorityHost           string
+		resourceManagerEndpoint string
+		expectative             Environment
+	}
+	conditions := [5]testGetEnvironment{
+		{"", "", "", PublicCloud},
+		{"public", "", "", PublicCloud},
+		{"China", "", "", ChinaCloud},
+		{"usgov", "", "", USGovernmentCloud},
+		{"custom", "https://login.example.com", "https://management.example.com", Environment{
+			Name:                    "custom",
+			AuthorityHost:           "https://login.example.com/",
+			ResourceManagerEndpoint: "https://management.example.com/",
+			TokenAudience:           "https://management.example.com",
+			ResourcesAPIVersion:     defaultResourcesAPIVersion,
+			MetricsAPIVersion:       defaultMetricsAPIVersion,
+		}},
+	}
+
+	for _, condition := range conditions {
+
+		dataReturn, err := GetEnvironment(condition.name, condition.authorityHost, condition.resourceManagerEndpoint, "")
+		if err != nil {
+			t.Error(err)
+		}
+		if dataReturn != condition.expectative {
+			t.Errorf(errorMessageData, condition.expectative, dataReturn)
+		}
+	}
+}
+
+func TestGetEnvironmentInvalidScenarios(t *testing.T) {
+
+	conditions := [3]string{"germany", "custom", "xxxxxxxx"}
+
+	for _, condition := range conditions {
+
+		_, err := GetEnvironment(condition, "", "", "")
+		if err == nil {
+			t.Errorf(errorMessageData, "error", condition)
+		}
+	}
+}
+
+func TestDiscoverEnvironment(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/endpoints" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"galleryEndpoint":"","graphEndpoint":"","portalEndpoint":"","authentication":{"loginEndpoint":"https://adfs.local.azurestack.external/adfs","audiences":["https://management.adfs.azurestack.local/0123"]}}`))
+	}))
+	defer server.Close()
+
+	environment, err := DiscoverEnvironment(server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if environment.AuthorityHost != "https://adfs.local.azurestack.external/" {
+		t.Errorf(errorMessageData, "https://adfs.local.azurestack.external/", environment.AuthorityHost)
+	}
+
+	if environment.TokenAudience != "https://management.adfs.azurestack.local/0123" {
+		t.Errorf(errorMessageData, "https://management.adfs.azurestack.local/0123", environment.TokenAudience)
+	}
+
+	if environment.ResourceManagerEndpoint != server.URL+"/" {
+		t.Errorf(errorMessageData, server.URL+"/", environment.ResourceManagerEndpoint)
+	}
+}
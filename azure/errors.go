@@ -0,0 +1,111 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var aadstsCode = regexp.MustCompile(`AADSTS\d+`)
+
+// AuthError represents an error returned by Azure Active Directory or by a managed identity
+// endpoint, or a token response that could not be understood.
+type AuthError struct {
+	StatusCode    int    `json:"-"`
+	Code          string `json:"error"`
+	Description   string `json:"error_description"`
+	ErrorCodes    []int  `json:"error_codes"`
+	CorrelationID string `json:"correlation_id"`
+	TraceID       string `json:"trace_id"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// newAuthError decodes the error body of a token endpoint response
+func newAuthError(resp *http.Response, body []byte) *AuthError {
+	authErr := &AuthError{}
+
+	// bodies that are not JSON still produce an error carrying the status code
+	if json.Unmarshal(body, authErr) != nil {
+		authErr = &AuthError{Description: strings.TrimSpace(string(body))}
+	}
+
+	authErr.StatusCode = resp.StatusCode
+	if authErr.CorrelationID == "" {
+		authErr.CorrelationID = resp.Header.Get("client-request-id")
+	}
+	if authErr.TraceID == "" {
+		authErr.TraceID = resp.Header.Get("x-ms-request-id")
+	}
+
+	return authErr
+}
+
+// invalidTokenResponse reports a successful response whose body is not a usable token
+func invalidTokenResponse(resp *http.Response, description string) *AuthError {
+	return &AuthError{
+		StatusCode:    resp.StatusCode,
+		Code:          "invalid_response",
+		Description:   description,
+		CorrelationID: resp.Header.Get("client-request-id"),
+		TraceID:       resp.Header.Get("x-ms-request-id"),
+	}
+}
+
+// AADSTSCode returns the AADSTS code of the error, such as AADSTS7000215 for an invalid secret
+func (e *AuthError) AADSTSCode() string {
+	if len(e.ErrorCodes) > 0 {
+		return "AADSTS" + strconv.Itoa(e.ErrorCodes[0])
+	}
+	return aadstsCode.FindString(e.Description)
+}
+
+// Reason returns the most specific code of the error: the AADSTS code, the OAuth error code or the HTTP status
+func (e *AuthError) Reason() string {
+	if code := e.AADSTSCode(); code != "" {
+		return code
+	}
+	if e.Code != "" {
+		return e.Code
+	}
+	return "http_" + strconv.Itoa(e.StatusCode)
+}
+
+// Error implements the error interface
+func (e *AuthError) Error() string {
+	message := fmt.Sprintf("Authentication failed with status code %d: %s", e.StatusCode, e.Reason())
+
+	if e.Description != "" {
+		// AADSTS descriptions span several lines with trace and correlation ids already reported below
+		message += ": " + strings.SplitN(e.Description, "\r\n", 2)[0]
+	}
+
+	if e.CorrelationID != "" {
+		message += fmt.Sprintf(" (correlation id %s", e.CorrelationID)
+		if e.TraceID != "" {
+			message += fmt.Sprintf(", trace id %s", e.TraceID)
+		}
+		message += ")"
+	}
+
+	return message
+}
+
+// AuthFailureReason returns the label used to count the authentication failure err
+func AuthFailureReason(err error) string {
+	if authErr, ok := err.(*AuthError); ok {
+		return authErr.Reason()
+	}
+	return "request_failed"
+}
+
+// StatusError is returned when Azure Resource Manager answers a list request with an unexpected status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Unable to query API with status code: %d", e.StatusCode)
+}
@@ -0,0 +1,61 @@
+package azure
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func TestReadTokenResponseAuthError(t *testing.T) {
+
+	body := `{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret provided.\r\nTrace ID: 1\r\nCorrelation ID: 2","error_codes":[7000215],"timestamp":"2019-01-01 00:00:00Z","trace_id":"trace","correlation_id":"correlation"}`
+
+	_, err := readTokenResponse(newTestResponse(401, body), "target")
+
+	authErr, ok := err.(*AuthError)
+	if !ok {
+		t.Fatalf(errorMessageData, "*AuthError", err)
+	}
+
+	if authErr.Reason() != "AADSTS7000215" {
+		t.Errorf(errorMessageData, "AADSTS7000215", authErr.Reason())
+	}
+
+	if !strings.Contains(authErr.Error(), "correlation id correlation") || strings.Contains(authErr.Error(), "Trace ID") {
+		t.Errorf(errorMessageData, "correlation id correlation", authErr.Error())
+	}
+}
+
+func TestReadTokenResponseInvalidScenarios(t *testing.T) {
+
+	type testReadTokenResponse struct {
+		statusCode  int
+		body        string
+		expectative string
+	}
+	conditions := [5]testReadTokenResponse{
+		{200, `{}`, "invalid_response"},
+		{200, `{"access_token":1}`, "invalid_response"},
+		{200, `{"access_token":"token"}`, "invalid_response"},
+		{200, `not json`, "invalid_response"},
+		{503, `Service Unavailable`, "http_503"},
+	}
+
+	for _, condition := range conditions {
+
+		_, err := readTokenResponse(newTestResponse(condition.statusCode, condition.body), "target")
+		if AuthFailureReason(err) != condition.expectative {
+			t.Errorf(errorMessageData, condition.expectative, AuthFailureReason(err))
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ResourceFilter selects resources on their tags, resource group, type, location and name.
+// Every condition must match. Tag conditions are written "name" (the tag exists), "!name" (the
+// tag does not exist) or "name=pattern" (the tag value matches). The other conditions are
+// patterns, anchored to the whole value and case insensitive like Azure names.
+type ResourceFilter struct {
+	Tags                  []string `yaml:"tags"`
+	AnyTags               []string `yaml:"anyTags"`
+	ResourceGroups        []string `yaml:"resourceGroups"`
+	ExcludeResourceGroups []string `yaml:"excludeResourceGroups"`
+	ResourceTypes         []string `yaml:"resourceTypes"`
+	ExcludeResourceTypes  []string `yaml:"excludeResourceTypes"`
+	Locations             []string `yaml:"locations"`
+	Names                 []string `yaml:"names"`
+
+	compiled *compiledFilter
+}
+
+type compiledFilter struct {
+	tags, anyTags                         []tagCondition
+	resourceGroups, excludeResourceGroups []*regexp.Regexp
+	resourceTypes, excludeResourceTypes   []*regexp.Regexp
+	locations, names                      []*regexp.Regexp
+}
+
+type tagCondition struct {
+	name   string
+	absent bool
+	value  *regexp.Regexp
+}
+
+// filterParameters are the scrape query parameters of the filter conditions
+var filterParameters = []string{"tag", "anyTag", "resourceGroup", "excludeResourceGroup", "resourceType", "excludeResourceType", "location", "name"}
+
+// ParseResourceFilter reads the filter from scrape query parameters, each condition being
+// repeatable, for example "?tag=team=payments&tag=!legacy&location=brazil.*"
+func ParseResourceFilter(values url.Values) (ResourceFilter, error) {
+	filter := ResourceFilter{
+		Tags:                  values["tag"],
+		AnyTags:               values["anyTag"],
+		ResourceGroups:        values["resourceGroup"],
+		ExcludeResourceGroups: values["excludeResourceGroup"],
+		ResourceTypes:         values["resourceType"],
+		ExcludeResourceTypes:  values["excludeResourceType"],
+		Locations:             values["location"],
+		Names:                 values["name"],
+	}
+
+	return filter, filter.Compile()
+}
+
+// Values returns the filter as scrape query parameters
+func (f *ResourceFilter) Values() url.Values {
+	values := url.Values{}
+
+	for index, conditions := range [][]string{f.Tags, f.AnyTags, f.ResourceGroups, f.ExcludeResourceGroups, f.ResourceTypes, f.ExcludeResourceTypes, f.Locations, f.Names} {
+		for _, condition := range conditions {
+			values.Add(filterParameters[index], condition)
+		}
+	}
+
+	return values
+}
+
+// String returns the filter in the query parameter syntax
+func (f *ResourceFilter) String() string {
+	return f.Values().Encode()
+}
+
+// IsEmpty checks if the filter has no condition
+func (f *ResourceFilter) IsEmpty() bool {
+	return len(f.Values()) == 0
+}
+
+// Compile checks the conditions of the filter and prepares them for matching
+func (f *ResourceFilter) Compile() error {
+	compiled := &compiledFilter{}
+	var err error
+
+	if compiled.tags, err = compileTagConditions(f.Tags); err != nil {
+		return err
+	}
+	if compiled.anyTags, err = compileTagConditions(f.AnyTags); err != nil {
+		return err
+	}
+
+	patterns := []struct {
+		source []string
+		target *[]*regexp.Regexp
+	}{
+		{f.ResourceGroups, &compiled.resourceGroups},
+		{f.ExcludeResourceGroups, &compiled.excludeResourceGroups},
+		{f.ResourceTypes, &compiled.resourceTypes},
+		{f.ExcludeResourceTypes, &compiled.excludeResourceTypes},
+		{f.Locations, &compiled.locations},
+		{f.Names, &compiled.names},
+	}
+
+	for _, pattern := range patterns {
+		if *pattern.target, err = compileFilterPatterns(pattern.source); err != nil {
+			return err
+		}
+	}
+
+	f.compiled = compiled
+
+	return nil
+}
+
+func compileTagConditions(conditions []string) ([]tagCondition, error) {
+	compiled := []tagCondition{}
+
+	for _, condition := range conditions {
+		var tag tagCondition
+
+		switch {
+		case strings.HasPrefix(condition, "!"):
+			tag.name = condition[1:]
+			tag.absent = true
+		case strings.Contains(condition, "="):
+			parts := strings.SplitN(condition, "=", 2)
+			value, err := regexp.Compile("(?i)^(?:" + parts[1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid tag condition %s: %v", condition, err)
+			}
+			tag.name, tag.value = parts[0], value
+		default:
+			tag.name = condition
+		}
+
+		if tag.name == "" {
+			return nil, fmt.Errorf("Invalid tag condition %s: the tag name is empty", condition)
+		}
+
+		compiled = append(compiled, tag)
+	}
+
+	return compiled, nil
+}
+
+func compileFilterPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+
+	for _, pattern := range patterns {
+		expression, err := regexp.Compile("(?i)^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid filter pattern %s: %v", pattern, err)
+		}
+		compiled = append(compiled, expression)
+	}
+
+	return compiled, nil
+}
+
+// Match checks the resource against every condition of the filter
+func (f *ResourceFilter) Match(resource Resource) bool {
+
+	if f.compiled == nil {
+		if err := f.Compile(); err != nil {
+			return false
+		}
+	}
+	c := f.compiled
+
+	for _, tag := range c.tags {
+		if !tag.match(resource.Tags) {
+			return false
+		}
+	}
+
+	if len(c.anyTags) > 0 {
+		matched := false
+		for _, tag := range c.anyTags {
+			if tag.match(resource.Tags) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	resourceGroup := ResourceGroupOf(resource.ID)
+
+	return matchIncludeExclude(c.resourceGroups, c.excludeResourceGroups, resourceGroup) &&
+		matchIncludeExclude(c.resourceTypes, c.excludeResourceTypes, resource.Type) &&
+		matchIncludeExclude(c.locations, nil, resource.Location) &&
+		matchIncludeExclude(c.names, nil, resource.Name)
+}
+
+func (tag tagCondition) match(tags map[string]string) bool {
+
+	value, found := "", false
+	for name, tagValue := range tags {
+		if strings.EqualFold(name, tag.name) {
+			value, found = tagValue, true
+			break
+		}
+	}
+
+	if tag.absent {
+		return !found
+	}
+
+	if tag.value == nil {
+		return found
+	}
+
+	return found && tag.value.MatchString(value)
+}
+
+func matchIncludeExclude(include, exclude []*regexp.Regexp, value string) bool {
+
+	if len(include) > 0 {
+		matched := false
+		for _, pattern := range include {
+			if pattern.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, pattern := range exclude {
+		if pattern.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// armFilter returns the $filter of Azure Resource Manager narrowing the list for the filter.
+// Resource Manager only filters on a single tag, so the first tag required by the filter is used
+// and every condition is still checked once the resources are listed. Only the tag name is sent:
+// Resource Manager leaves the tags out of the resources listed by tag value, which would fail the
+// conditions checked afterwards.
+func (f *ResourceFilter) armFilter() string {
+
+	if f.compiled == nil {
+		if err := f.Compile(); err != nil {
+			return ""
+		}
+	}
+
+	for _, tag := range f.compiled.tags {
+		if tag.absent || strings.Contains(tag.name, "'") {
+			continue
+		}
+		return fmt.Sprintf("tagName eq '%s'", tag.name)
+	}
+
+	return ""
+}
+
+// ResourceGroupOf returns the resource group of the resource ID
+func ResourceGroupOf(resourceID string) string {
+	parts := strings.Split(resourceID, "/")
+	if len(parts) < 5 || !strings.EqualFold(parts[3], "resourceGroups") {
+		return ""
+	}
+
+	return parts[4]
+}
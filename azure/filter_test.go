@@ -0,0 +1,93 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestResourceFilterMatch(t *testing.T) {
+
+	filter, err := ParseResourceFilter(url.Values{
+		"tag":                  {"team=payments", "env", "!legacy"},
+		"anyTag":               {"tier=gold|silver", "critical"},
+		"excludeResourceGroup": {"rg-sandbox.*"},
+		"resourceType":         {"Microsoft.Web/sites"},
+		"location":             {"brazil.*"},
+		"name":                 {"api-.*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := Resource{
+		ID:       "/subscriptions/s/resourceGroups/rg-prd/providers/Microsoft.Web/sites/api-checkout",
+		Name:     "api-checkout",
+		Type:     "microsoft.web/sites",
+		Location: "brazilsouth",
+		Tags:     map[string]string{"Team": "Payments", "env": "prd", "tier": "gold"},
+	}
+
+	if !filter.Match(resource) {
+		t.Errorf(errorMessageData, "true", fmt.Sprint(resource))
+	}
+
+	conditions := []func(r *Resource){
+		func(r *Resource) {
+			r.Tags = map[string]string{"team": "payments", "env": "prd", "critical": "yes", "legacy": "yes"}
+		},
+		func(r *Resource) { r.Tags = map[string]string{"team": "payments", "env": "prd", "tier": "bronze"} },
+		func(r *Resource) { r.Tags = map[string]string{"team": "checkout", "env": "prd", "tier": "gold"} },
+		func(r *Resource) {
+			r.ID = "/subscriptions/s/resourceGroups/rg-sandbox-1/providers/Microsoft.Web/sites/api-checkout"
+		},
+		func(r *Resource) { r.Location = "eastus" },
+		func(r *Resource) { r.Name = "worker" },
+	}
+
+	for index, condition := range conditions {
+		changed := resource
+		condition(&changed)
+		if filter.Match(changed) {
+			t.Errorf(errorMessageData, fmt.Sprint(index), fmt.Sprint(changed))
+		}
+	}
+}
+
+func TestResourceFilterARMFilter(t *testing.T) {
+
+	conditions := map[string]string{
+		"tag=team=payments":      "tagName eq 'team'",
+		"tag=project=my%5C.app":  "tagName eq 'project'",
+		"tag=team=pay.*&tag=env": "tagName eq 'team'",
+		"tag=!legacy&tag=env":    "tagName eq 'env'",
+		"tag=!legacy":            "",
+		"location=brazilsouth":   "",
+	}
+
+	for query, expected := range conditions {
+		values, _ := url.ParseQuery(query)
+		filter, err := ParseResourceFilter(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if armFilter := filter.armFilter(); armFilter != expected {
+			t.Errorf(errorMessageData, expected, armFilter)
+		}
+	}
+}
+
+func TestParseResourceFilterInvalidScenarios(t *testing.T) {
+
+	conditions := []url.Values{
+		{"tag": {"team=("}},
+		{"tag": {"!"}},
+		{"location": {"["}},
+	}
+
+	for _, condition := range conditions {
+		if _, err := ParseResourceFilter(condition); err == nil {
+			t.Errorf(errorMessageData, "error", condition)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// managedIdentityTimeout bounds a token request, so an unresponsive endpoint cannot hang a scrape
+const managedIdentityTimeout = 30 * time.Second
+
+// managedIdentityCredential acquires tokens from the managed identity endpoint of the host.
+// Virtual machines and AKS nodes expose the instance metadata service (IMDS), while App Service
+// and Functions expose their own endpoint through IDENTITY_ENDPOINT and IDENTITY_HEADER.
+type managedIdentityCredential struct {
+	client     *http.Client
+	clientID   string
+	endpoint   string
+	header     string
+	apiVersion string
+}
+
+// newManagedIdentityCredential creates the credential for the system-assigned identity, or for the
+// user-assigned identity identified by clientID. An empty endpoint selects the one of the host.
+func newManagedIdentityCredential(clientID, endpoint string) *managedIdentityCredential {
+	credential := &managedIdentityCredential{
+		client:     &http.Client{Timeout: managedIdentityTimeout},
+		clientID:   clientID,
+		endpoint:   endpoint,
+		header:     os.Getenv("IDENTITY_HEADER"),
+		apiVersion: "2018-02-01",
+	}
+
+	if credential.endpoint == "" {
+		credential.endpoint = os.Getenv("IDENTITY_ENDPOINT")
+	}
+
+	if credential.endpoint == "" {
+		credential.endpoint = imdsEndpoint
+		credential.header = ""
+	}
+
+	if credential.header != "" {
+		credential.apiVersion = "2019-08-01"
+	}
+
+	return credential
+}
+
+// GetToken requests a token for the audience from the managed identity endpoint
+func (c *managedIdentityCredential) GetToken(audience string) (Token, error) {
+
+	req, err := http.NewRequest("GET", c.endpoint, nil)
+	if err != nil {
+		return Token{}, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+
+	if c.header != "" {
+		req.Header.Set("X-IDENTITY-HEADER", c.header)
+	} else {
+		req.Header.Set("Metadata", "true")
+	}
+
+	values := url.Values{}
+	values.Add("api-version", c.apiVersion)
+	values.Add("resource", audienceResource(audience))
+	if c.clientID != "" {
+		values.Add("client_id", c.clientID)
+	}
+
+	req.URL.RawQuery = values.Encode()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error in GET %s", c.endpoint), err)
+		return Token{}, fmt.Errorf("Error authenticating against managed identity endpoint: %v", err)
+	}
+
+	return readTokenResponse(resp, c.endpoint)
+}
@@ -0,0 +1,79 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestManagedIdentityCredentialGetToken(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("client_id") != "my-identity" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"token","expires_on":"1546300800","resource":"` + r.URL.Query().Get("resource") + `","token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	credential := newManagedIdentityCredential("my-identity", server.URL)
+
+	token, err := credential.GetToken(PublicCloud.TokenAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "token" {
+		t.Errorf(errorMessageData, "token", token.AccessToken)
+	}
+
+	if token.Resource != PublicCloud.TokenAudience {
+		t.Errorf(errorMessageData, PublicCloud.TokenAudience, token.Resource)
+	}
+
+	if token.ExpiresOn.Unix() != 1546300800 {
+		t.Errorf(errorMessageData, "1546300800", token.ExpiresOn)
+	}
+}
+
+func TestManagedIdentityCredentialAppService(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "identity-header" || r.Header.Get("Metadata") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("api-version") != "2019-08-01" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"app-service-token","expires_on":"1546300800","resource":"` + r.URL.Query().Get("resource") + `","token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("IDENTITY_ENDPOINT", server.URL)
+	os.Setenv("IDENTITY_HEADER", "identity-header")
+	defer os.Unsetenv("IDENTITY_ENDPOINT")
+	defer os.Unsetenv("IDENTITY_HEADER")
+
+	credential := newManagedIdentityCredential("", "")
+
+	if credential.endpoint != server.URL {
+		t.Errorf(errorMessageData, server.URL, credential.endpoint)
+	}
+
+	token, err := credential.GetToken(PublicCloud.TokenAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "app-service-token" {
+		t.Errorf(errorMessageData, "app-service-token", token.AccessToken)
+	}
+}
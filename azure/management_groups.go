@@ -0,0 +1,49 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const managementGroupsAPIVersion = "2020-05-01"
+
+// GetManagementGroupSubscriptions walks the descendants of the management group and returns
+// the subscriptions found at any depth below it
+func (ac *Client) GetManagementGroupSubscriptions(groupID string) ([]Subscription, error) {
+
+	if groupID == "" {
+		return nil, fmt.Errorf("Management group is empty")
+	}
+
+	descendantsTarget := fmt.Sprintf("%sproviders/Microsoft.Management/managementGroups/%s/descendants", ac.environment.ResourceManagerEndpoint, url.PathEscape(groupID))
+
+	values := url.Values{}
+	values.Add("api-version", managementGroupsAPIVersion)
+
+	subscriptions := []Subscription{}
+	err := ac.getPages("managementGroupDescendants", descendantsTarget, values, func(body []byte) (string, error) {
+		var page ManagementGroupDescendantResponse
+		err := json.Unmarshal(body, &page)
+		for _, descendant := range page.Value {
+			if descendant.Type != "/subscriptions" {
+				continue
+			}
+			subscriptions = append(subscriptions, Subscription{
+				ID:              descendant.ID,
+				SubscriptionID:  descendant.Name,
+				DisplayName:     descendant.Properties.DisplayName,
+				ManagementGroup: groupID,
+			})
+		}
+		return page.NextLink, err
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetManagementGroupSubscriptions] - Error listing descendants of %s", groupID), err)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
@@ -0,0 +1,40 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetManagementGroupSubscriptions(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/providers/Microsoft.Management/managementGroups/landing-zone/descendants" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"value":[
+			{"id":"/providers/Microsoft.Management/managementGroups/corp","type":"Microsoft.Management/managementGroups","name":"corp","properties":{"displayName":"Corp"}},
+			{"id":"/subscriptions/subscription-a","type":"/subscriptions","name":"subscription-a","properties":{"displayName":"billing-prd","parent":{"id":"/providers/Microsoft.Management/managementGroups/corp"}}}
+		]}`)
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("management-group", environment, &countingCredential{})
+
+	subscriptions, err := ac.GetManagementGroupSubscriptions("landing-zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subscriptions) != 1 {
+		t.Fatalf(errorMessageQuantity, "1", fmt.Sprint(len(subscriptions)))
+	}
+
+	if subscriptions[0].SubscriptionID != "subscription-a" || subscriptions[0].DisplayName != "billing-prd" || subscriptions[0].ManagementGroup != "landing-zone" {
+		t.Errorf(errorMessageData, "subscription-a", subscriptions[0])
+	}
+}
@@ -0,0 +1,147 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricTypes remembers which resource types support Azure Monitor metrics, learnt by probing the
+// metric definitions of the first resource of each type. Types are compared case insensitively
+// and kept per Resource Manager endpoint, since clouds do not support the same types.
+var metricTypes = struct {
+	sync.Mutex
+	ttl       time.Duration
+	supported map[string]metricTypeEntry
+	include   map[string]bool
+	exclude   map[string]bool
+}{
+	supported: make(map[string]metricTypeEntry),
+	include:   make(map[string]bool),
+	exclude:   make(map[string]bool),
+}
+
+type metricTypeEntry struct {
+	supported bool
+	fetched   time.Time
+}
+
+var metricTypesDesc = prometheus.NewDesc("azure_exporter_metric_resource_types", "Number of resource types probed for metric support.", []string{"supported"}, nil)
+
+func init() {
+	prometheus.MustRegister(metricTypesCollector{})
+}
+
+// SetMetricTypeOverrides sets the resource types always considered to support metrics, without
+// probing, and those never scraped
+func SetMetricTypeOverrides(include, exclude []string) {
+	metricTypes.Lock()
+	defer metricTypes.Unlock()
+
+	metricTypes.include = make(map[string]bool)
+	for _, resourceType := range include {
+		metricTypes.include[strings.ToLower(resourceType)] = true
+	}
+
+	metricTypes.exclude = make(map[string]bool)
+	for _, resourceType := range exclude {
+		metricTypes.exclude[strings.ToLower(resourceType)] = true
+	}
+}
+
+// SetMetricTypeTTL sets how long the support of a resource type is remembered before the type
+// is probed again. 0 probes every resource.
+func SetMetricTypeTTL(ttl time.Duration) {
+	metricTypes.Lock()
+	defer metricTypes.Unlock()
+
+	metricTypes.ttl = ttl
+}
+
+// ValidateTypeMetric valid if the resource type has some metric definition in the azure api. The
+// first resource of an unknown type is probed, and the answer is kept for the type until the TTL
+// elapses. Failures that do not tell whether the type supports metrics, like throttling or a
+// resource deleted meanwhile, are not kept. The definitions of a probed resource are returned so
+// they do not have to be requested again, nil when the resource was not probed.
+func (ac *Client) ValidateTypeMetric(resource Resource) (bool, *MetricDefinitionResponse) {
+
+	resourceType := strings.ToLower(strings.TrimSpace(resource.Type))
+	if resourceType == "" {
+		return false, nil
+	}
+	key := ac.environment.ResourceManagerEndpoint + "|" + resourceType
+
+	metricTypes.Lock()
+	if metricTypes.exclude[resourceType] {
+		metricTypes.Unlock()
+		return false, nil
+	}
+	if metricTypes.include[resourceType] {
+		metricTypes.Unlock()
+		return true, nil
+	}
+	entry, known := metricTypes.supported[key]
+	ttl := metricTypes.ttl
+	metricTypes.Unlock()
+
+	if known && time.Since(entry.fetched) < ttl {
+		return entry.supported, nil
+	}
+
+	definitions, err := ac.GetMetricTypes(resource.ID, resource.Type)
+	if err != nil {
+		// 400 is returned for types without metrics, while 404 only tells about this resource
+		statusError, ok := err.(*StatusError)
+		if !ok || statusError.StatusCode != 400 {
+			logger.Error(fmt.Sprintf("[ValidateTypeMetric] - Unable to probe metric support of %s", resource.Type), err)
+			return false, nil
+		}
+	}
+
+	supported := err == nil && len(definitions.MetricDefinitionResponses) > 0
+
+	logger.Info(fmt.Sprintf("[ValidateTypeMetric] - Resource type %s supports metrics: %t", resource.Type, supported))
+
+	metricTypes.Lock()
+	metricTypes.supported[key] = metricTypeEntry{supported: supported, fetched: time.Now()}
+	metricTypes.Unlock()
+
+	if !supported {
+		return false, nil
+	}
+
+	return true, &definitions
+}
+
+// resetMetricTypes forgets the probed resource types
+func resetMetricTypes() {
+	metricTypes.Lock()
+	defer metricTypes.Unlock()
+
+	metricTypes.supported = make(map[string]metricTypeEntry)
+}
+
+type metricTypesCollector struct{}
+
+// Describe sends the descriptor of the probed resource types metric
+func (c metricTypesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricTypesDesc
+}
+
+// Collect sends the number of probed resource types supporting metrics and not supporting them
+func (c metricTypesCollector) Collect(ch chan<- prometheus.Metric) {
+	metricTypes.Lock()
+	defer metricTypes.Unlock()
+
+	counts := map[bool]float64{true: 0, false: 0}
+	for _, entry := range metricTypes.supported {
+		counts[entry.supported]++
+	}
+
+	ch <- prometheus.MustNewConstMetric(metricTypesDesc, prometheus.GaugeValue, counts[true], "true")
+	ch <- prometheus.MustNewConstMetric(metricTypesDesc, prometheus.GaugeValue, counts[false], "false")
+}
@@ -0,0 +1,127 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTypeMetricProbesOncePerType(t *testing.T) {
+
+	probes := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resourceType := strings.Split(r.URL.Path, "/")[7]
+		probes[resourceType]++
+		switch resourceType {
+		case "sites":
+			fmt.Fprint(w, `{"value":[{"name":{"value":"CpuTime"}}]}`)
+		case "availabilitySets":
+			w.WriteHeader(http.StatusBadRequest)
+		case "throttled":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "deleted":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			fmt.Fprint(w, `{"value":[]}`)
+		}
+	}))
+	defer server.Close()
+
+	resetMetricTypes()
+	defer resetMetricTypes()
+	SetMetricTypeTTL(time.Hour)
+	defer SetMetricTypeTTL(0)
+	SetMetricTypeOverrides([]string{"Microsoft.Custom/included"}, []string{"microsoft.web/SERVERFARMS"})
+	defer SetMetricTypeOverrides(nil, nil)
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL
+	ac := newAzureClient("metric-types", environment, &countingCredential{})
+
+	resource := func(resourceType, name string) Resource {
+		parts := strings.Split(resourceType, "/")
+		return Resource{ID: fmt.Sprintf("/subscriptions/s/resourceGroups/rg/providers/%s/%s/%s", parts[0], parts[1], name), Type: resourceType}
+	}
+
+	type testValidateTypeMetric struct {
+		resource    Resource
+		expectative bool
+	}
+	conditions := []testValidateTypeMetric{
+		{resource("Microsoft.Web/sites", "a"), true},
+		{resource("microsoft.web/SITES", "b"), true},
+		{resource("Microsoft.Web/site", "c"), false},
+		{resource("Microsoft.Compute/availabilitySets", "d"), false},
+		{resource("Microsoft.Compute/availabilitySets", "e"), false},
+		{resource("Microsoft.Test/throttled", "f"), false},
+		{resource("Microsoft.Test/throttled", "g"), false},
+		{resource("Microsoft.Test/deleted", "j"), false},
+		{resource("Microsoft.Test/deleted", "k"), false},
+		{resource("Microsoft.Custom/included", "h"), true},
+		{resource("Microsoft.Web/serverFarms", "i"), false},
+		{Resource{Type: "         "}, false},
+	}
+
+	for _, condition := range conditions {
+		if dataReturn, _ := ac.ValidateTypeMetric(condition.resource); dataReturn != condition.expectative {
+			t.Errorf(errorMessageData, fmt.Sprint(condition.expectative), condition.resource.Type)
+		}
+	}
+
+	expectedProbes := map[string]int{"sites": 1, "site": 1, "availabilitySets": 1, "throttled": 2, "deleted": 2, "included": 0, "serverFarms": 0}
+	for resourceType, expected := range expectedProbes {
+		if probes[resourceType] != expected {
+			t.Errorf(errorMessageQuantity, fmt.Sprint(expected), fmt.Sprint(probes[resourceType]))
+		}
+	}
+}
+
+func TestValidateTypeMetricReturnsProbedDefinitions(t *testing.T) {
+
+	probes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		fmt.Fprint(w, `{"value":[{"name":{"value":"CpuTime"}}]}`)
+	}))
+	defer server.Close()
+
+	resetMetricTypes()
+	defer resetMetricTypes()
+	SetMetricTypeTTL(time.Hour)
+	defer SetMetricTypeTTL(0)
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL
+	ac := newAzureClient("metric-types", environment, &countingCredential{})
+
+	resource := Resource{ID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Web/sites/a", Type: "Microsoft.Web/sites"}
+
+	supported, definitions := ac.ValidateTypeMetric(resource)
+	if !supported || definitions == nil || len(definitions.MetricDefinitionResponses) != 1 {
+		t.Fatalf(errorMessageData, "CpuTime", fmt.Sprint(definitions))
+	}
+
+	if _, definitions := ac.ValidateTypeMetric(resource); definitions != nil {
+		t.Errorf(errorMessageData, "nil", fmt.Sprint(definitions))
+	}
+
+	// Another cloud probes the type again
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	other := newAzureClient("metric-types", environment, &countingCredential{})
+	other.ValidateTypeMetric(resource)
+
+	if probes != 2 {
+		t.Errorf(errorMessageQuantity, "2", fmt.Sprint(probes))
+	}
+
+	// Expired types are probed again
+	SetMetricTypeTTL(0)
+	ac.ValidateTypeMetric(resource)
+
+	if probes != 3 {
+		t.Errorf(errorMessageQuantity, "3", fmt.Sprint(probes))
+	}
+}
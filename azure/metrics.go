@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,83 +16,70 @@ import (
 
 // GetMetricTypes Loop through all specified resource targets and get their respective metric definitions.
 func (ac *Client) GetMetricTypes(resourceName, resourceType string) (MetricDefinitionResponse, error) {
-	err := ac.validateAccesssToken()
+	apiVersion := ac.environment.MetricsAPIVersion
 
-	if err != nil {
-		logger.Error("[GetMetricTypes] - Error in validation access token", err)
-		return MetricDefinitionResponse{}, fmt.Errorf("Error refreshing access token: %v", err)
-	}
-
-	apiVersion := "2018-01-01"
-
-	metricsTarget := fmt.Sprintf("%s%s/providers/microsoft.insights/metricDefinitions", ac.resource, resourceName)
-	req, err := http.NewRequest("GET", metricsTarget, nil)
-	if err != nil {
-		return MetricDefinitionResponse{}, fmt.Errorf("Error creating HTTP request: %v", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+ac.accessToken)
+	metricsTarget := fmt.Sprintf("%s%s/providers/microsoft.insights/metricDefinitions", ac.environment.ResourceManagerEndpoint, resourceName)
 	values := url.Values{}
 	values.Add("api-version", apiVersion)
 
-	req.URL.RawQuery = values.Encode()
-
-	resp, err := ac.client.Do(req)
-	if err != nil {
-		logger.Error(fmt.Sprintf("[GetMetricTypes] - Error in GET %s", req.URL), err)
-		return MetricDefinitionResponse{}, fmt.Errorf("Error: %v", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		logger.Error(fmt.Sprintf("[GetMetricTypes] - Error in GET %s", req.URL), resp.StatusCode)
-		return MetricDefinitionResponse{}, fmt.Errorf("Unable to query metrics API with status code: %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logger.Error(fmt.Sprintf("[GetMetricTypes] - Error in GET %s", req.URL), err)
-		return MetricDefinitionResponse{}, fmt.Errorf("Error reading body of response: %v", err)
-	}
-
 	var data MetricDefinitionResponse
-	err = json.Unmarshal(body, &data)
+	err := ac.getPages("metricDefinitions", metricsTarget, values, func(body []byte) (string, error) {
+		var page MetricDefinitionResponse
+		err := json.Unmarshal(body, &page)
+		data.MetricDefinitionResponses = append(data.MetricDefinitionResponses, page.MetricDefinitionResponses...)
+		return page.NextLink, err
+	})
 	if err != nil {
-		logger.Error(fmt.Sprintf("[GetMetricTypes] - Error in GET %s", req.URL), err)
-		return MetricDefinitionResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+		logger.Error("[GetMetricTypes] - Error listing metric definitions", err)
+		return MetricDefinitionResponse{}, err
 	}
 
 	return data, nil
 }
 
 // GetMetric retrieves resource metrics in azure
-func (ac *Client) GetMetric(resource, metricNames, aggregation string) (MetricValueResponse, error) {
+func (ac *Client) GetMetric(resource string, query MetricQuery) (MetricValueResponse, error) {
 
-	err := ac.validateAccesssToken()
+	if query.Filter != "" && strings.Contains(query.MetricNames, ",") {
+		return MetricValueResponse{}, fmt.Errorf("Dimension filter %s requested for several metrics %s", query.Filter, query.MetricNames)
+	}
+
+	accessToken, err := ac.getAccessToken()
 
 	if err != nil {
 		logger.Error("[GetMetric] - Error in validation access token", err)
 		return MetricValueResponse{}, fmt.Errorf("Error refreshing access token: %v", err)
 	}
 
-	apiVersion := "2018-01-01"
+	apiVersion := ac.environment.MetricsAPIVersion
 
-	endTime, startTime := getTimes()
+	endTime, startTime := getTimes(query.Window, time.Now())
 
-	metricValueEndpoint := fmt.Sprintf("%s%s/providers/microsoft.insights/metrics", ac.resource, resource)
+	metricValueEndpoint := fmt.Sprintf("%s%s/providers/microsoft.insights/metrics", ac.environment.ResourceManagerEndpoint, resource)
 
 	req, err := http.NewRequest("GET", metricValueEndpoint, nil)
 	if err != nil {
 		logger.Error(fmt.Sprintf("[GetMetric] - Error in GET %s", req.URL), req)
 		return MetricValueResponse{}, fmt.Errorf("Error creating HTTP request: %v", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+ac.accessToken)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	values := url.Values{}
-	if metricNames != "" {
-		values.Add("metricnames", metricNames)
+	if query.MetricNames != "" {
+		values.Add("metricnames", query.MetricNames)
+	}
+	if query.Filter != "" {
+		values.Add("$filter", query.Filter)
+	}
+	if query.Top > 0 {
+		values.Add("top", strconv.Itoa(query.Top))
 	}
 
-	values.Add("aggregation", aggregation)
+	values.Add("aggregation", query.Aggregation)
 	values.Add("timespan", fmt.Sprintf("%s/%s", startTime, endTime))
+	if query.Window.Interval > 0 {
+		values.Add("interval", formatISODuration(query.Window.Interval))
+	}
 	values.Add("api-version", apiVersion)
 
 	req.URL.RawQuery = values.Encode()
@@ -123,17 +111,6 @@ func (ac *Client) GetMetric(resource, metricNames, aggregation string) (MetricVa
 	return data, nil
 }
 
-// GetTimes - Returns the endTime and startTime used for querying Azure Metrics API
-func getTimes() (string, string) {
-	// Make sure we are using UTC
-	now := time.Now().UTC()
-
-	// Use query delay of 3 minutes when querying for latest metric data
-	endTime := now.Add(time.Minute * time.Duration(-3)).Format(time.RFC3339)
-	startTime := now.Add(time.Minute * time.Duration(-4)).Format(time.RFC3339)
-	return endTime, startTime
-}
-
 // TreatTypeMetric performs metric type api return processing for use in metric api
 func TreatTypeMetric(typeMetrics MetricDefinitionResponse) []string {
 	if len(typeMetrics.MetricDefinitionResponses) <= 0 {
@@ -165,27 +142,9 @@ func TreatTypeMetric(typeMetrics MetricDefinitionResponse) []string {
 	return definitions
 }
 
-const typesAllowed = "Microsoft.AnalysisServices/servers,CloudSimple.PrivateCloudIaaS/virtualMachines,Microsoft.Web/serverFarms,Microsoft.Web/sites,Microsoft.Web/sites/slots,Microsoft.Web/hostingEnvironments/multiRolePools,Microsoft.Web/hostingEnvironments/workerPools,test.shoebox/testresources,test.shoebox/testresources2,Microsoft.ServiceBus/namespaces,Microsoft.Network/virtualNetworks,Microsoft.Network/publicIPAddresses,Microsoft.Network/networkInterfaces,Microsoft.Network/loadBalancers,Microsoft.Network/networkWatchers/connectionMonitors,Microsoft.Network/virtualNetworkGateways,Microsoft.Network/connections,Microsoft.Network/applicationGateways,Microsoft.Network/dnszones,Microsoft.Network/trafficmanagerprofiles,Microsoft.Network/expressRouteCircuits,Microsoft.Network/expressRoutePorts,Microsoft.Network/azureFirewalls,Microsoft.Network/frontdoors,Microsoft.DBforMySQL/servers,Microsoft.Sql/servers,Microsoft.Sql/servers/databases,Microsoft.Sql/servers/elasticpools,Microsoft.Sql/managedInstances,microsoft.insights/components,microsoft.insights/autoscalesettings,Microsoft.KeyVault/vaults,Microsoft.Cache/Redis,Microsoft.ContainerRegistry/registries,Microsoft.LocationBasedServices/accounts,Microsoft.DocumentDB/databaseAccounts,Microsoft.ContainerInstance/containerGroups,Microsoft.Devices/IotHubs,Microsoft.Devices/ElasticPools,Microsoft.Devices/ElasticPools/IotHubTenants,Microsoft.Devices/ProvisioningServices,Microsoft.Compute/virtualMachines,Microsoft.Compute/virtualMachineScaleSets,Microsoft.Compute/virtualMachineScaleSets/virtualMachines,Microsoft.ClassicCompute/domainNames/slots/roles,Microsoft.ClassicCompute/virtualMachines,Microsoft.SignalRService/SignalR,Microsoft.DataBoxEdge/DataBoxEdgeDevices,Microsoft.Search/searchServices,Microsoft.Logic/workflows,Microsoft.Logic/integrationServiceEnvironments,Microsoft.HDInsight/clusters,Microsoft.Relay/namespaces,Microsoft.EventHub/namespaces,Microsoft.EventHub/clusters,Microsoft.Kusto/clusters,Microsoft.OperationalInsights/workspaces,Microsoft.Maps/accounts,Microsoft.DBforMariaDB/servers,Microsoft.TimeSeriesInsights/environments,Microsoft.TimeSeriesInsights/environments/eventsources,Microsoft.DBforPostgreSQL/servers,Microsoft.StreamAnalytics/streamingjobs,Microsoft.NotificationHubs/namespaces/notificationHubs,Microsoft.ApiManagement/service,Microsoft.Storage/storageAccounts,Microsoft.Storage/storageAccounts/blobServices,Microsoft.Storage/storageAccounts/tableServices,Microsoft.Storage/storageAccounts/queueServices,Microsoft.Storage/storageAccounts/fileServices,Microsoft.DataLakeAnalytics/accounts,Microsoft.PowerBIDedicated/capacities,Microsoft.IoTSpaces/Graph,Microsoft.Automation/automationAccounts,Microsoft.DataLakeStore/accounts,Microsoft.DataFactory/dataFactories,Microsoft.DataFactory/factories,Microsoft.NetApp/netAppAccounts/capacityPools,Microsoft.NetApp/netAppAccounts/capacityPools/volumes,Microsoft.StorageSync/storageSyncServices,Microsoft.StorageSync/storageSyncServices/syncGroups,Microsoft.StorageSync/storageSyncServices/syncGroups/serverEndpoints,Microsoft.StorageSync/storageSyncServices/registeredServers,Microsoft.ContainerService/managedClusters,Microsoft.CustomerInsights/hubs,Microsoft.Batch/batchAccounts,Microsoft.EventGrid/eventSubscriptions,Microsoft.EventGrid/topics,Microsoft.EventGrid/domains,Microsoft.EventGrid/extensionTopics,Microsoft.CognitiveServices/accounts"
-
-// ValidateTypeMetric valid if the resource type has some metric definition in the azure api
-func ValidateTypeMetric(metricType string) bool {
-
-	if metricType == "" || strings.Trim(metricType, " ") == "" {
-		return false
-	}
-
-	if !strings.Contains(typesAllowed, metricType) {
-		return false
-	}
-
-	return true
-}
-
 // SanitizeMetric is the method responsible for performing all treatments in the metrics recovered in azure
 func (value *MetricValueResponseValue) SanitizeMetric(resourceType string) error {
 
-	metricValue := value.Timeseries[0].Data[len(value.Timeseries[0].Data)-1]
-
 	value.Unit = strings.ToLower(value.Unit)
 	if value.Unit != "milliseconds" {
 		metricName, err := sanitizeMetricName(value.Name.Value, value.Unit, resourceType)
@@ -199,10 +158,15 @@ func (value *MetricValueResponseValue) SanitizeMetric(resourceType string) error
 	}
 
 	value.Unit = "seconds"
-	metricValue.Total = convertMillisToSeconds(metricValue.Total)
-	metricValue.Average = convertMillisToSeconds(metricValue.Average)
-	metricValue.Maximum = convertMillisToSeconds(metricValue.Maximum)
-	metricValue.Minimum = convertMillisToSeconds(metricValue.Minimum)
+	for index := range value.Timeseries {
+		for point := range value.Timeseries[index].Data {
+			metricValue := &value.Timeseries[index].Data[point]
+			metricValue.Total = convertMillisToSeconds(metricValue.Total)
+			metricValue.Average = convertMillisToSeconds(metricValue.Average)
+			metricValue.Maximum = convertMillisToSeconds(metricValue.Maximum)
+			metricValue.Minimum = convertMillisToSeconds(metricValue.Minimum)
+		}
+	}
 
 	metricName, err := sanitizeMetricName(value.Name.Value, value.Unit, resourceType)
 
@@ -125,29 +125,6 @@ func TestTreatTypeMetricEmptyValues(t *testing.T) {
 	}
 }
 
-func TestValidateTypeMetricRealMetric(t *testing.T) {
-
-	type testValidateTypeMetric struct {
-		typeMetric  string
-		expectative bool
-	}
-	conditions := [5]testValidateTypeMetric{
-		{"Microsoft.AnalysisServices/servers", true},
-		{"Microsoft.Compute/availabilitySets", false},
-		{"xxxxxxxxxxxxxxxxxx", false},
-		{"", false},
-		{"         ", false},
-	}
-
-	for _, condition := range conditions {
-
-		dataReturn := ValidateTypeMetric(condition.typeMetric)
-		if dataReturn != condition.expectative {
-			t.Error(errorMessageData, dataReturn, condition.expectative)
-		}
-	}
-}
-
 func TestConvertMillisToSecondsValidScenarios(t *testing.T) {
 
 	type testConvertMillisToSeconds struct {
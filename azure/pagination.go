@@ -0,0 +1,124 @@
+package azure
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dasa-health/elk-logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPages stops following nextLink on lists that never end
+const maxPages = 500
+
+var pagesFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "azure_exporter_pages_fetched_total",
+	Help: "Number of pages fetched from Azure Resource Manager list APIs.",
+}, []string{"api"})
+
+func init() {
+	prometheus.MustRegister(pagesFetched)
+}
+
+// getPages requests target with the query values, then every page announced by nextLink. The body
+// of each page is passed to page, which decodes it and returns the link of the next page.
+func (ac *Client) getPages(api, target string, values url.Values, page func(body []byte) (string, error)) error {
+
+	accessToken, err := ac.getAccessToken()
+
+	if err != nil {
+		logger.Error("[getPages] - Error in validation access token", err)
+		return fmt.Errorf("Error refreshing access token: %v", err)
+	}
+
+	link := target + "?" + values.Encode()
+
+	for pages := 0; link != ""; pages++ {
+
+		if pages >= maxPages {
+			logger.Error(fmt.Sprintf("[getPages] - Stopped following nextLink of %s after %d pages", target, maxPages))
+			return fmt.Errorf("Error listing %s: more than %d pages", target, maxPages)
+		}
+
+		if pages > 0 && !ac.onResourceManager(link) {
+			logger.Error(fmt.Sprintf("[getPages] - nextLink of %s leaves %s: %s", target, ac.environment.ResourceManagerEndpoint, link))
+			return fmt.Errorf("Error listing %s: nextLink is not on the Resource Manager endpoint", target)
+		}
+
+		body, err := ac.get(link, accessToken)
+		if err != nil {
+			return err
+		}
+
+		pagesFetched.WithLabelValues(api).Inc()
+
+		link, err = page(body)
+		if err != nil {
+			logger.Error(fmt.Sprintf("[getPages] - Error in GET %s", target), err)
+			return fmt.Errorf("Error unmarshalling response body: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// onResourceManager reports whether link points at the Resource Manager endpoint of the client,
+// so the access token is never sent to another host announced by a nextLink
+func (ac *Client) onResourceManager(link string) bool {
+	endpoint, err := url.Parse(ac.environment.ResourceManagerEndpoint)
+	if err != nil {
+		return false
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(parsed.Scheme, endpoint.Scheme) && strings.EqualFold(parsed.Host, endpoint.Host)
+}
+
+// get requests link and returns the body of the response
+func (ac *Client) get(link, accessToken string) ([]byte, error) {
+	return ac.send("GET", link, accessToken, nil)
+}
+
+// post sends the JSON payload to link and returns the body of the response
+func (ac *Client) post(link, accessToken string, payload []byte) ([]byte, error) {
+	return ac.send("POST", link, accessToken, payload)
+}
+
+func (ac *Client) send(method, link, accessToken string, payload []byte) ([]byte, error) {
+
+	req, err := http.NewRequest(method, link, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[getPages] - Error in %s %s", method, req.URL), err)
+		return nil, fmt.Errorf("Error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		logger.Error(fmt.Sprintf("[getPages] - Error in %s %s", method, req.URL), resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[getPages] - Error in %s %s", method, req.URL), err)
+		return nil, fmt.Errorf("Error reading body of response: %v", err)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,82 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetResourcesFollowsNextLink(t *testing.T) {
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("$skiptoken") {
+		case "":
+			fmt.Fprintf(w, `{"value":[{"id":"a","name":"a","type":"Microsoft.Web/sites"}],"nextLink":"%s/subscriptions/subscription/resources?$skiptoken=page2"}`, server.URL)
+		case "page2":
+			fmt.Fprint(w, `{"value":[{"id":"b","name":"b","type":"Microsoft.Web/sites"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("pagination", environment, &countingCredential{})
+
+	resources, err := ac.GetResources("subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources.Value) != 2 {
+		t.Fatalf(errorMessageQuantity, "2", fmt.Sprint(len(resources.Value)))
+	}
+
+	if resources.Value[1].Name != "b" {
+		t.Errorf(errorMessageData, "b", resources.Value[1].Name)
+	}
+}
+
+func TestGetResourcesStopsAtMaxPages(t *testing.T) {
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"value":[],"nextLink":"%s/subscriptions/subscription/resources?$skiptoken=next"}`, server.URL)
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("pagination", environment, &countingCredential{})
+
+	// A truncated list must not be taken, and cached, as the complete one
+	if _, err := ac.GetResources("subscription"); err == nil {
+		t.Errorf(errorMessageData, "error", "truncated list")
+	}
+}
+
+func TestGetResourcesRejectsForeignNextLink(t *testing.T) {
+
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf(errorMessageData, "no request", r.Header.Get("Authorization"))
+	}))
+	defer foreign.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"value":[],"nextLink":"%s/subscriptions/subscription/resources?$skiptoken=next"}`, foreign.URL)
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("pagination", environment, &countingCredential{})
+
+	if _, err := ac.GetResources("subscription"); err == nil {
+		t.Errorf(errorMessageData, "error", "nextLink on another host")
+	}
+}
@@ -0,0 +1,87 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const resourceGraphAPIVersion = "2021-03-01"
+
+// Azure Resource Graph accepts up to 1000 subscriptions and returns up to 1000 rows per request
+const resourceGraphBatchSize = 1000
+
+// QueryResources selects the resources of the subscriptions with the KQL query, which is piped
+// after the Resources table of Azure Resource Graph, for example
+// "where tags.team == 'payments' and location == 'brazilsouth'".
+func (ac *Client) QueryResources(subscriptionIDs []string, query string) ([]Resource, error) {
+
+	if query == "" {
+		return nil, fmt.Errorf("Resource Graph query is empty")
+	}
+
+	accessToken, err := ac.getAccessToken()
+
+	if err != nil {
+		logger.Error("[QueryResources] - Error in validation access token", err)
+		return nil, fmt.Errorf("Error refreshing access token: %v", err)
+	}
+
+	values := url.Values{}
+	values.Add("api-version", resourceGraphAPIVersion)
+	resourceGraphTarget := fmt.Sprintf("%sproviders/Microsoft.ResourceGraph/resources?%s", ac.environment.ResourceManagerEndpoint, values.Encode())
+
+	request := ResourceGraphRequest{
+		Query: fmt.Sprintf("Resources | %s | project id, name, type, location, kind, managedBy, sku, tags", query),
+		Options: ResourceGraphRequestOptions{
+			Top:          resourceGraphBatchSize,
+			ResultFormat: "objectArray",
+		},
+	}
+
+	resources := []Resource{}
+	for start := 0; start < len(subscriptionIDs); start += resourceGraphBatchSize {
+
+		end := start + resourceGraphBatchSize
+		if end > len(subscriptionIDs) {
+			end = len(subscriptionIDs)
+		}
+		request.Subscriptions = subscriptionIDs[start:end]
+		request.Options.SkipToken = ""
+
+		for pages := 0; pages == 0 || request.Options.SkipToken != ""; pages++ {
+
+			if pages >= maxPages {
+				logger.Error(fmt.Sprintf("[QueryResources] - Stopped following $skipToken after %d pages", maxPages))
+				break
+			}
+
+			payload, err := json.Marshal(request)
+			if err != nil {
+				return nil, fmt.Errorf("Error marshalling Resource Graph request: %v", err)
+			}
+
+			body, err := ac.post(resourceGraphTarget, accessToken, payload)
+			if err != nil {
+				logger.Error("[QueryResources] - Error querying Resource Graph", err)
+				return nil, err
+			}
+
+			pagesFetched.WithLabelValues("resourceGraph").Inc()
+
+			var page ResourceGraphResponse
+			err = json.Unmarshal(body, &page)
+			if err != nil {
+				logger.Error(fmt.Sprintf("[QueryResources] - Error in POST %s", resourceGraphTarget), err)
+				return nil, fmt.Errorf("Error unmarshalling response body: %v", err)
+			}
+
+			resources = append(resources, page.Data...)
+			request.Options.SkipToken = page.SkipToken
+		}
+	}
+
+	return resources, nil
+}
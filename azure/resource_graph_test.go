@@ -0,0 +1,48 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueryResourcesFollowsSkipToken(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request ResourceGraphRequest
+		if r.Method != "POST" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if request.Query != "Resources | where tags.team == 'payments' | project id, name, type, location, kind, managedBy, sku, tags" || len(request.Subscriptions) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch request.Options.SkipToken {
+		case "":
+			fmt.Fprint(w, `{"totalRecords":2,"count":1,"data":[{"id":"/subscriptions/a/resourceGroups/rg/providers/Microsoft.Web/sites/a","name":"a","type":"microsoft.web/sites","location":"brazilsouth","tags":{"team":"payments"}}],"$skipToken":"page2"}`)
+		case "page2":
+			fmt.Fprint(w, `{"totalRecords":2,"count":1,"data":[{"id":"/subscriptions/b/resourceGroups/rg/providers/Microsoft.Web/sites/b","name":"b","type":"microsoft.web/sites","location":"eastus","tags":null}]}`)
+		}
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("resource-graph", environment, &countingCredential{})
+
+	resources, err := ac.QueryResources([]string{"a", "b"}, "where tags.team == 'payments'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources) != 2 {
+		t.Fatalf(errorMessageQuantity, "2", fmt.Sprint(len(resources)))
+	}
+
+	if resources[0].Location != "brazilsouth" || resources[0].Tags["team"] != "payments" {
+		t.Errorf(errorMessageData, "brazilsouth", fmt.Sprint(resources[0]))
+	}
+}
@@ -3,72 +3,108 @@ package azure
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
-	"os"
 
 	"github.com/dasa-health/elk-logger"
 )
 
-// GetResources get all resoures from azure
-func (ac *Client) GetResources(tagValue string) (ResourceResponse, error) {
+// GetResources get all resoures from azure in the subscription matching every filter. The list is
+// narrowed by $filter when Resource Manager can express one of the conditions, the others are
+// checked once the resources are listed.
+func (ac *Client) GetResources(subscriptionID string, filters ...ResourceFilter) (ResourceResponse, error) {
 
-	if tagValue == "" {
-		return ResourceResponse{}, fmt.Errorf("Tag value is empty")
+	if subscriptionID == "" {
+		return ResourceResponse{}, fmt.Errorf("Subscription is empty")
 	}
 
-	err := ac.validateAccesssToken()
+	return ac.listResources(fmt.Sprintf("%ssubscriptions/%s/resources", ac.environment.ResourceManagerEndpoint, subscriptionID), filters)
+}
 
-	if err != nil {
-		logger.Error("[GetResources] - Error in validation access token", err)
-		return ResourceResponse{}, fmt.Errorf("Error refreshing access token: %v", err)
-	}
-	apiVersion := "2018-05-01"
-	subscriptionID := os.Getenv("subscriptionId")
-	metricValueEndpoint := fmt.Sprintf("%ssubscriptions/%s/resources", ac.resource, subscriptionID)
+// GetResourceGroupResources get all resources of the resource group matching every filter, for
+// credentials that can only read some resource groups of the subscription
+func (ac *Client) GetResourceGroupResources(subscriptionID, resourceGroup string, filters ...ResourceFilter) (ResourceResponse, error) {
 
-	log.Print(metricValueEndpoint)
-	req, err := http.NewRequest("GET", metricValueEndpoint, nil)
-	if err != nil {
-		logger.Error(fmt.Sprintf("[GetResources] - Error in GET %s", req.URL), err)
-		return ResourceResponse{}, fmt.Errorf("Error creating HTTP request: %v", err)
+	if subscriptionID == "" || resourceGroup == "" {
+		return ResourceResponse{}, fmt.Errorf("Subscription or resource group is empty")
 	}
-	req.Header.Set("Authorization", "Bearer "+ac.accessToken)
 
-	values := url.Values{}
-	resourceQuery := fmt.Sprintf("tagName eq '%s' and tagValue eq '%s'", os.Getenv("resourceQueryTagName"), tagValue)
-	if resourceQuery != "" {
-		values.Add("$filter", resourceQuery)
+	return ac.listResources(fmt.Sprintf("%ssubscriptions/%s/resourceGroups/%s/resources", ac.environment.ResourceManagerEndpoint, subscriptionID, url.PathEscape(resourceGroup)), filters)
+}
+
+// GetResourceGroups lists the resource groups of the subscription readable with the client credential
+func (ac *Client) GetResourceGroups(subscriptionID string) ([]ResourceGroup, error) {
+
+	if subscriptionID == "" {
+		return nil, fmt.Errorf("Subscription is empty")
 	}
-	values.Add("api-version", apiVersion)
 
-	req.URL.RawQuery = values.Encode()
+	resourceGroupsTarget := fmt.Sprintf("%ssubscriptions/%s/resourcegroups", ac.environment.ResourceManagerEndpoint, subscriptionID)
 
-	resp, err := ac.client.Do(req)
+	values := url.Values{}
+	values.Add("api-version", ac.environment.ResourcesAPIVersion)
+
+	resourceGroups := []ResourceGroup{}
+	err := ac.getPages("resourceGroups", resourceGroupsTarget, values, func(body []byte) (string, error) {
+		var page ResourceGroupResponse
+		err := json.Unmarshal(body, &page)
+		resourceGroups = append(resourceGroups, page.Value...)
+		return page.NextLink, err
+	})
 	if err != nil {
-		logger.Error(fmt.Sprintf("[GetResources] - Error in GET %s", req.URL), err)
-		return ResourceResponse{}, fmt.Errorf("Error: %v", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		logger.Error(fmt.Sprintf("[GetResources] - Error in GET %s", req.URL), resp.StatusCode)
-		return ResourceResponse{}, fmt.Errorf("Unable to query metrics API with status code: %d", resp.StatusCode)
+		logger.Error("[GetResourceGroups] - Error listing resource groups", err)
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logger.Error(fmt.Sprintf("[GetResources] - Error in GET %s", req.URL), err)
-		return ResourceResponse{}, fmt.Errorf("Error reading body of response: %v", err)
+	return resourceGroups, nil
+}
+
+func (ac *Client) listResources(metricValueEndpoint string, filters []ResourceFilter) (ResourceResponse, error) {
+
+	apiVersion := ac.environment.ResourcesAPIVersion
+
+	log.Print(metricValueEndpoint)
+
+	values := url.Values{}
+	for index := range filters {
+		if resourceQuery := filters[index].armFilter(); resourceQuery != "" {
+			values.Add("$filter", resourceQuery)
+			break
+		}
 	}
+	values.Add("api-version", apiVersion)
 
 	var data ResourceResponse
-	err = json.Unmarshal(body, &data)
+	err := ac.getPages("resources", metricValueEndpoint, values, func(body []byte) (string, error) {
+		var page ResourceResponse
+		err := json.Unmarshal(body, &page)
+		data.Value = append(data.Value, FilterResources(page.Value, filters...)...)
+		return page.NextLink, err
+	})
 	if err != nil {
-		logger.Error(fmt.Sprintf("[GetResources] - Error in GET %s", req.URL), err)
-		return ResourceResponse{}, fmt.Errorf("Error unmarshalling response body: %v", err)
+		logger.Error("[GetResources] - Error listing resources", err)
+		return ResourceResponse{}, err
 	}
 
 	return data, nil
 }
+
+// FilterResources returns the resources matching every filter
+func FilterResources(resources []Resource, filters ...ResourceFilter) []Resource {
+	selected := []Resource{}
+
+	for _, resource := range resources {
+		matched := true
+		for index := range filters {
+			if !filters[index].Match(resource) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			selected = append(selected, resource)
+		}
+	}
+
+	return selected
+}
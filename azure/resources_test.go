@@ -0,0 +1,82 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetResourceGroupResources(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subscriptions/subscription/resourcegroups":
+			fmt.Fprint(w, `{"value":[{"id":"/subscriptions/subscription/resourceGroups/rg-payments","name":"rg-payments","location":"brazilsouth"}]}`)
+		case "/subscriptions/subscription/resourceGroups/rg-payments/resources":
+			fmt.Fprint(w, `{"value":[{"id":"/subscriptions/subscription/resourceGroups/rg-payments/providers/Microsoft.Web/sites/a","name":"a","type":"Microsoft.Web/sites"}]}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("resource-groups", environment, &countingCredential{})
+
+	resourceGroups, err := ac.GetResourceGroups("subscription")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resourceGroups) != 1 || resourceGroups[0].Name != "rg-payments" {
+		t.Errorf(errorMessageData, "rg-payments", resourceGroups)
+	}
+
+	resources, err := ac.GetResourceGroupResources("subscription", "rg-payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources.Value) != 1 || resources.Value[0].Name != "a" {
+		t.Errorf(errorMessageData, "a", fmt.Sprint(resources.Value))
+	}
+
+	_, err = ac.GetResourceGroupResources("subscription", "rg-other")
+	if statusError, ok := err.(*StatusError); !ok || statusError.StatusCode != http.StatusForbidden {
+		t.Errorf(errorMessageData, "403", err)
+	}
+}
+
+func TestGetResourcesTagFilter(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("$filter") {
+		case "tagName eq 'team'":
+			fmt.Fprint(w, `{"value":[
+				{"id":"/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Web/sites/a","name":"a","tags":{"team":"payments"}},
+				{"id":"/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Web/sites/b","name":"b","tags":{"team":"billing"}}
+			]}`)
+		case "tagName eq 'team' and tagValue eq 'payments'":
+			// Resource Manager leaves the tags out of resources listed by tag value
+			fmt.Fprint(w, `{"value":[{"id":"/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Web/sites/a","name":"a"}]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	environment := PublicCloud
+	environment.ResourceManagerEndpoint = server.URL + "/"
+	ac := newAzureClient("tag-filter", environment, &countingCredential{})
+
+	resources, err := ac.GetResources("subscription", ResourceFilter{Tags: []string{"team=payments"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources.Value) != 1 || resources.Value[0].Name != "a" || resources.Value[0].Tags["team"] != "payments" {
+		t.Errorf(errorMessageData, "a", fmt.Sprint(resources.Value))
+	}
+}
@@ -0,0 +1,105 @@
+package azure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const secretFilePrefix = "file:"
+
+// Secret is a setting given inline or as a reference to a file. Files are read again
+// whenever they change, so secrets rotated by Kubernetes are picked up without a restart.
+type Secret struct {
+	value string
+	path  string
+	file  *secretFile
+}
+
+type secretFile struct {
+	mutex   sync.Mutex
+	modTime time.Time
+	content string
+}
+
+// NewSecret creates a secret from value, which references a file when prefixed with "file:"
+func NewSecret(value string) Secret {
+	if strings.HasPrefix(value, secretFilePrefix) {
+		return NewFileSecret(strings.TrimPrefix(value, secretFilePrefix))
+	}
+	return Secret{value: value}
+}
+
+// NewFileSecret creates a secret read from the file at path
+func NewFileSecret(path string) Secret {
+	return Secret{path: path, file: &secretFile{}}
+}
+
+// SecretFromEnv reads the secret from the environment variable name, or from the file
+// named by the variable name_FILE when it is set
+func SecretFromEnv(name string) Secret {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return NewFileSecret(path)
+	}
+	return NewSecret(os.Getenv(name))
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	*s = NewSecret(value)
+	return nil
+}
+
+// IsEmpty reports whether the secret has neither a value nor a file
+func (s Secret) IsEmpty() bool {
+	return s.value == "" && s.path == ""
+}
+
+// String returns the file reference, or a placeholder for inline values, so that secrets are
+// never written to logs
+func (s Secret) String() string {
+	if s.path != "" {
+		return secretFilePrefix + s.path
+	}
+	if s.value != "" {
+		return "<secret>"
+	}
+	return ""
+}
+
+// Value returns the secret, reading the file again when it has been modified
+func (s Secret) Value() (string, error) {
+	if s.path == "" {
+		return s.value, nil
+	}
+
+	s.file.mutex.Lock()
+	defer s.file.mutex.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading secret file: %v", err)
+	}
+
+	if !s.file.modTime.IsZero() && info.ModTime().Equal(s.file.modTime) {
+		return s.file.content, nil
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading secret file: %v", err)
+	}
+
+	s.file.content = strings.TrimSpace(string(content))
+	s.file.modTime = info.ModTime()
+
+	return s.file.content, nil
+}
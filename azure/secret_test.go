@@ -0,0 +1,64 @@
+package azure
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSecretValueReloadsFile(t *testing.T) {
+
+	file, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	if err := ioutil.WriteFile(file.Name(), []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := NewSecret("file:" + file.Name())
+
+	value, err := secret.Value()
+	if err != nil || value != "first" {
+		t.Errorf(errorMessageData, "first", value)
+	}
+
+	if err := ioutil.WriteFile(file.Name(), []byte("second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file.Name(), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err = secret.Value()
+	if err != nil || value != "second" {
+		t.Errorf(errorMessageData, "second", value)
+	}
+
+	if secret.String() != "file:"+file.Name() {
+		t.Errorf(errorMessageData, "file:"+file.Name(), secret.String())
+	}
+}
+
+func TestSecretValueInline(t *testing.T) {
+
+	secret := NewSecret("inline")
+
+	value, err := secret.Value()
+	if err != nil || value != "inline" {
+		t.Errorf(errorMessageData, "inline", value)
+	}
+
+	if secret.String() != "<secret>" {
+		t.Errorf(errorMessageData, "<secret>", secret.String())
+	}
+
+	if NewSecret("").IsEmpty() != true {
+		t.Errorf(errorMessageData, "true", "false")
+	}
+}
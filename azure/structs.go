@@ -1,39 +1,173 @@
 package azure
 
 import (
+	"encoding/json"
 	"net/http"
-	"time"
 )
 
 // Client represents our client to talk to the Azure api
 type Client struct {
-	client               *http.Client
-	accessToken          string
-	accessTokenExpiresOn time.Time
-	resource             string
+	client      *http.Client
+	name        string
+	environment Environment
+	credential  Credential
 }
 
-func newAzureClient() Client {
+func newAzureClient(name string, environment Environment, credential Credential) Client {
 	return Client{
-		client:               &http.Client{},
-		accessToken:          "",
-		accessTokenExpiresOn: time.Time{},
-		resource:             "",
+		client:      &http.Client{},
+		name:        name,
+		environment: environment,
+		credential:  credential,
 	}
 }
 
+// MetadataEndpointsResponse represents the endpoints advertised by an Azure Resource Manager installation
+type MetadataEndpointsResponse struct {
+	GalleryEndpoint string `json:"galleryEndpoint"`
+	GraphEndpoint   string `json:"graphEndpoint"`
+	PortalEndpoint  string `json:"portalEndpoint"`
+	Authentication  struct {
+		LoginEndpoint string   `json:"loginEndpoint"`
+		Audiences     []string `json:"audiences"`
+	} `json:"authentication"`
+}
+
+// TokenResponse represents the response of the Azure AD and managed identity token endpoints.
+// The v1 and managed identity endpoints return expires_on, the v2.0 endpoint only expires_in.
+type TokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	Resource    string      `json:"resource"`
+	ExpiresIn   json.Number `json:"expires_in"`
+	ExpiresOn   json.Number `json:"expires_on"`
+}
+
+// AzureCLIAccessToken represents the output of "az account get-access-token"
+type AzureCLIAccessToken struct {
+	AccessToken        string      `json:"accessToken"`
+	ExpiresOn          string      `json:"expiresOn"`
+	ExpiresOnTimestamp json.Number `json:"expires_on"`
+	Tenant             string      `json:"tenant"`
+	TokenType          string      `json:"tokenType"`
+}
+
+// AzureCLIToken represents a token cached by the Azure CLI in accessTokens.json
+type AzureCLIToken struct {
+	TokenType    string `json:"tokenType"`
+	ExpiresOn    string `json:"expiresOn"`
+	Resource     string `json:"resource"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	Authority    string `json:"_authority"`
+	ClientID     string `json:"_clientId"`
+}
+
+// SubscriptionResponse represents the list of subscriptions accessible to a credential
+type SubscriptionResponse struct {
+	Value    []Subscription `json:"value"`
+	NextLink string         `json:"nextLink"`
+}
+
+// Subscription represents an Azure subscription
+type Subscription struct {
+	ID             string `json:"id"`
+	SubscriptionID string `json:"subscriptionId"`
+	DisplayName    string `json:"displayName"`
+	State          string `json:"state"`
+
+	// ManagementGroup is the management group the subscription was discovered under
+	ManagementGroup string `json:"-"`
+}
+
+// ManagementGroupDescendantResponse represents the descendants of a management group
+type ManagementGroupDescendantResponse struct {
+	Value    []ManagementGroupDescendant `json:"value"`
+	NextLink string                      `json:"nextLink"`
+}
+
+// ManagementGroupDescendant represents a management group or subscription below a management group
+type ManagementGroupDescendant struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Properties struct {
+		DisplayName string `json:"displayName"`
+		Parent      struct {
+			ID string `json:"id"`
+		} `json:"parent"`
+	} `json:"properties"`
+}
+
+// ResourceGroupResponse represents the list of resource groups of a subscription
+type ResourceGroupResponse struct {
+	Value    []ResourceGroup `json:"value"`
+	NextLink string          `json:"nextLink"`
+}
+
+// ResourceGroup represents a resource group of a subscription
+type ResourceGroup struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+}
+
 // ResourceResponse represents generic resource for Azure
 type ResourceResponse struct {
-	Value []struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-		Type string `json:"type"`
-	} `json:"value"`
+	Value    []Resource `json:"value"`
+	NextLink string     `json:"nextLink"`
+}
+
+// Resource represents a resource listed by Azure Resource Manager
+type Resource struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Location  string            `json:"location"`
+	Kind      string            `json:"kind"`
+	ManagedBy string            `json:"managedBy"`
+	SKU       *ResourceSKU      `json:"sku"`
+	Tags      map[string]string `json:"tags"`
+
+	// Parent is the name of the parent of a child resource
+	Parent string `json:"-"`
+}
+
+// ResourceSKU represents the SKU of a resource
+type ResourceSKU struct {
+	Name     string `json:"name"`
+	Tier     string `json:"tier"`
+	Size     string `json:"size"`
+	Family   string `json:"family"`
+	Capacity int    `json:"capacity"`
+}
+
+// ResourceGraphRequest represents a query to Azure Resource Graph
+type ResourceGraphRequest struct {
+	Subscriptions []string                    `json:"subscriptions"`
+	Query         string                      `json:"query"`
+	Options       ResourceGraphRequestOptions `json:"options"`
+}
+
+// ResourceGraphRequestOptions represents the paging options of a query to Azure Resource Graph
+type ResourceGraphRequestOptions struct {
+	Top          int    `json:"$top"`
+	SkipToken    string `json:"$skipToken,omitempty"`
+	ResultFormat string `json:"resultFormat"`
+}
+
+// ResourceGraphResponse represents a page of resources returned by Azure Resource Graph
+type ResourceGraphResponse struct {
+	TotalRecords int        `json:"totalRecords"`
+	Count        int        `json:"count"`
+	Data         []Resource `json:"data"`
+	SkipToken    string     `json:"$skipToken"`
 }
 
 // MetricDefinitionResponse represents metric definition response for a given resource from Azure.
 type MetricDefinitionResponse struct {
 	MetricDefinitionResponses []metricDefinitionResponse `json:"value"`
+	NextLink                  string                     `json:"nextLink"`
 }
 type metricDefinitionResponse struct {
 	Dimensions []struct {
@@ -50,9 +184,10 @@ type metricDefinitionResponse struct {
 		LocalizedValue string `json:"localizedValue"`
 		Value          string `json:"value"`
 	} `json:"name"`
-	PrimaryAggregationType string `json:"primaryAggregationType"`
-	ResourceID             string `json:"resourceId"`
-	Unit                   string `json:"unit"`
+	PrimaryAggregationType    string   `json:"primaryAggregationType"`
+	SupportedAggregationTypes []string `json:"supportedAggregationTypes"`
+	ResourceID                string   `json:"resourceId"`
+	Unit                      string   `json:"unit"`
 }
 
 type metricDefinitionResponseName struct {
@@ -71,20 +206,50 @@ type MetricValueResponse struct {
 
 // MetricValueResponseValue represents a metric value detail response for a given metric definition.
 type MetricValueResponseValue struct {
-	Timeseries []struct {
-		Data []struct {
-			TimeStamp string  `json:"timeStamp"`
-			Total     float64 `json:"total"`
-			Average   float64 `json:"average"`
-			Minimum   float64 `json:"minimum"`
-			Maximum   float64 `json:"maximum"`
-		} `json:"data"`
-	} `json:"timeseries"`
-	ID   string `json:"id"`
-	Name struct {
+	Timeseries []MetricTimeseries `json:"timeseries"`
+	ID         string             `json:"id"`
+	Name       struct {
 		LocalizedValue string `json:"localizedValue"`
 		Value          string `json:"value"`
 	} `json:"name"`
 	Type string `json:"type"`
 	Unit string `json:"unit"`
 }
+
+// MetricTimeseries represents the values of a metric for one combination of its dimensions
+type MetricTimeseries struct {
+	MetadataValues []MetricMetadataValue `json:"metadatavalues"`
+	Data           []MetricData          `json:"data"`
+}
+
+// MetricData represents the aggregated values of a metric over a time grain
+type MetricData struct {
+	TimeStamp string  `json:"timeStamp"`
+	Total     float64 `json:"total"`
+	Average   float64 `json:"average"`
+	Minimum   float64 `json:"minimum"`
+	Maximum   float64 `json:"maximum"`
+	Count     float64 `json:"count"`
+}
+
+// MetricMetadataValue represents the value of a dimension of a timeseries
+type MetricMetadataValue struct {
+	Name struct {
+		LocalizedValue string `json:"localizedValue"`
+		Value          string `json:"value"`
+	} `json:"name"`
+	Value string `json:"value"`
+}
+
+// MetricQuery selects the metrics requested from a resource
+type MetricQuery struct {
+	MetricNames string
+	// Aggregation is the comma separated list of aggregations, like "Average,Maximum"
+	Aggregation string
+	// Filter is the $filter on the dimensions of the metric, which Azure Monitor only accepts
+	// with a single metric name
+	Filter string
+	Top    int
+	// Window is the timespan and interval of the query, the zero window queries the last minute
+	Window MetricWindow
+}
@@ -0,0 +1,34 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const subscriptionsAPIVersion = "2016-06-01"
+
+// GetSubscriptions lists the subscriptions accessible with the client credential
+func (ac *Client) GetSubscriptions() ([]Subscription, error) {
+
+	subscriptionsTarget := fmt.Sprintf("%ssubscriptions", ac.environment.ResourceManagerEndpoint)
+
+	values := url.Values{}
+	values.Add("api-version", subscriptionsAPIVersion)
+
+	subscriptions := []Subscription{}
+	err := ac.getPages("subscriptions", subscriptionsTarget, values, func(body []byte) (string, error) {
+		var page SubscriptionResponse
+		err := json.Unmarshal(body, &page)
+		subscriptions = append(subscriptions, page.Value...)
+		return page.NextLink, err
+	})
+	if err != nil {
+		logger.Error("[GetSubscriptions] - Error listing subscriptions", err)
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
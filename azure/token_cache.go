@@ -0,0 +1,195 @@
+package azure
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// tokens are refreshed in the background this long before they expire
+	tokenRefreshBefore = 10 * time.Minute
+	// tokens closer than this to their expiry are never handed out
+	tokenExpiryMargin = time.Minute
+	// delay before retrying a failed background refresh
+	tokenRetryInterval = 30 * time.Second
+)
+
+var (
+	tokenProvidersMutex sync.Mutex
+	tokenProviders      = map[tokenProviderKey]*tokenProvider{}
+
+	tokenRefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_exporter_token_refresh_failures_total",
+		Help: "Number of failed attempts to acquire an access token.",
+	}, []string{"credential", "audience"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_exporter_auth_failures_total",
+		Help: "Number of authentication failures by AADSTS code, OAuth error code or HTTP status.",
+	}, []string{"code"})
+
+	tokenAgeDesc = prometheus.NewDesc(
+		"azure_exporter_token_age_seconds",
+		"Seconds since the cached access token was acquired.",
+		[]string{"credential", "audience"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(tokenRefreshFailures)
+	prometheus.MustRegister(authFailures)
+	prometheus.MustRegister(tokenCollector{})
+}
+
+type tokenProviderKey struct {
+	name     string
+	audience string
+}
+
+// tokenProvider caches the token of a credential for one audience and refreshes it in the
+// background shortly before it expires. It is shared by every Client using the credential, and
+// concurrent refreshes are collapsed into a single request to Azure Active Directory.
+type tokenProvider struct {
+	name       string
+	audience   string
+	credential Credential
+
+	mutex      sync.Mutex
+	token      Token
+	acquiredAt time.Time
+	err        error
+	refreshing chan struct{}
+	timer      *time.Timer
+}
+
+// getTokenProvider returns the process-wide provider of the named credential for the audience
+func getTokenProvider(name string, credential Credential, audience string) *tokenProvider {
+	tokenProvidersMutex.Lock()
+	defer tokenProvidersMutex.Unlock()
+
+	key := tokenProviderKey{name: name, audience: audience}
+	provider, ok := tokenProviders[key]
+	if !ok || provider.credential != credential {
+		if ok {
+			provider.stop()
+		}
+		provider = &tokenProvider{name: name, audience: audience, credential: credential}
+		tokenProviders[key] = provider
+	}
+
+	return provider
+}
+
+// Token returns the cached token, acquiring a new one when there is no valid token
+func (p *tokenProvider) Token() (Token, error) {
+	p.mutex.Lock()
+	token := p.token
+	p.mutex.Unlock()
+
+	if token.AccessToken != "" && time.Now().UTC().Before(token.ExpiresOn.Add(-tokenExpiryMargin)) {
+		return token, nil
+	}
+
+	return p.refresh()
+}
+
+// refresh acquires a new token, or waits for the refresh already in flight
+func (p *tokenProvider) refresh() (Token, error) {
+	p.mutex.Lock()
+	if p.refreshing != nil {
+		refreshing := p.refreshing
+		p.mutex.Unlock()
+		<-refreshing
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.err != nil {
+			return Token{}, p.err
+		}
+		return p.token, nil
+	}
+	refreshing := make(chan struct{})
+	p.refreshing = refreshing
+	p.mutex.Unlock()
+
+	token, err := p.credential.GetToken(p.audience)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.err = err
+	if err != nil {
+		tokenRefreshFailures.WithLabelValues(p.name, p.audience).Inc()
+		authFailures.WithLabelValues(AuthFailureReason(err)).Inc()
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error refreshing token of credential %s", p.name), err)
+		p.schedule(tokenRetryInterval)
+	} else {
+		p.token = token
+		p.acquiredAt = time.Now().UTC()
+		p.schedule(time.Until(token.ExpiresOn.Add(-tokenRefreshBefore)))
+	}
+
+	p.refreshing = nil
+	close(refreshing)
+
+	if err != nil {
+		return Token{}, err
+	}
+
+	return p.token, nil
+}
+
+// schedule plans the next background refresh. Must be called with the mutex held.
+func (p *tokenProvider) schedule(after time.Duration) {
+	if after < tokenRetryInterval {
+		after = tokenRetryInterval
+	}
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+
+	p.timer = time.AfterFunc(after, func() {
+		p.refresh()
+	})
+}
+
+func (p *tokenProvider) stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+}
+
+// tokenCollector exports the age of every cached token
+type tokenCollector struct{}
+
+// Describe sends the descriptor of the token age metric
+func (c tokenCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokenAgeDesc
+}
+
+// Collect sends the age of the token of each provider
+func (c tokenCollector) Collect(ch chan<- prometheus.Metric) {
+	tokenProvidersMutex.Lock()
+	defer tokenProvidersMutex.Unlock()
+
+	now := time.Now().UTC()
+	for _, provider := range tokenProviders {
+		provider.mutex.Lock()
+		acquiredAt := provider.acquiredAt
+		provider.mutex.Unlock()
+
+		if acquiredAt.IsZero() {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(tokenAgeDesc, prometheus.GaugeValue, now.Sub(acquiredAt).Seconds(), provider.name, provider.audience)
+	}
+}
@@ -0,0 +1,51 @@
+package azure
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingCredential struct {
+	calls int32
+}
+
+func (c *countingCredential) GetToken(resource string) (Token, error) {
+	atomic.AddInt32(&c.calls, 1)
+	time.Sleep(10 * time.Millisecond)
+	return Token{AccessToken: "token", Resource: resource, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestTokenProviderCollapsesConcurrentRefreshes(t *testing.T) {
+
+	credential := &countingCredential{}
+	provider := getTokenProvider("test", credential, PublicCloud.TokenAudience)
+	defer provider.stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := provider.Token()
+			if err != nil || token.AccessToken != "token" {
+				t.Errorf(errorMessageData, "token", token.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := provider.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := atomic.LoadInt32(&credential.calls); calls != 1 {
+		t.Errorf(errorMessageQuantity, "1", fmt.Sprint(calls))
+	}
+
+	if getTokenProvider("test", credential, PublicCloud.TokenAudience) != provider {
+		t.Error("Expected the provider to be shared by the credential")
+	}
+}
@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// MetricWindow is the time window of a metric query. The window ends Offset ago, rounded down to
+// a multiple of Interval so its last time grain is complete, and spans Timespan.
+type MetricWindow struct {
+	Timespan time.Duration
+	Interval time.Duration
+	Offset   time.Duration
+}
+
+// timeGrains are the intervals accepted by Azure Monitor
+var timeGrains = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour}
+
+var isoDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// IsTimeGrain checks if the interval is a time grain of Azure Monitor, from PT1M to P1D
+func IsTimeGrain(interval time.Duration) bool {
+	for _, grain := range timeGrains {
+		if interval == grain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getTimes - Returns the endTime and startTime used for querying Azure Metrics API
+func getTimes(window MetricWindow, now time.Time) (string, string) {
+	// Make sure we are using UTC
+	now = now.UTC()
+
+	interval := window.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	timespan := window.Timespan
+	if timespan < interval {
+		timespan = interval
+	}
+
+	end := now.Add(-window.Offset).Truncate(interval)
+	start := end.Add(-timespan)
+
+	return end.Format(time.RFC3339), start.Format(time.RFC3339)
+}
+
+// SmallestTimeGrain returns the smallest time grain in which the metric is available, zero when
+// the definition has none
+func (definition metricDefinitionResponse) SmallestTimeGrain() time.Duration {
+	var smallest time.Duration
+
+	for _, availability := range definition.MetricAvailabilities {
+		grain, err := parseISODuration(availability.TimeGrain)
+		if err != nil || grain <= 0 {
+			continue
+		}
+		if smallest == 0 || grain < smallest {
+			smallest = grain
+		}
+	}
+
+	return smallest
+}
+
+// parseISODuration parses the ISO 8601 durations used as time grains, like PT1M, PT1H or P1D
+func parseISODuration(value string) (time.Duration, error) {
+	parts := isoDurationRegexp.FindStringSubmatch(value)
+	if parts == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("Invalid ISO 8601 duration %s", value)
+	}
+
+	var duration time.Duration
+	for index, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if parts[index+1] == "" {
+			continue
+		}
+		amount, err := strconv.Atoi(parts[index+1])
+		if err != nil {
+			return 0, err
+		}
+		duration += time.Duration(amount) * unit
+	}
+
+	return duration, nil
+}
+
+// formatISODuration formats the duration in ISO 8601, like PT5M or P1D
+func formatISODuration(duration time.Duration) string {
+	days := duration / (24 * time.Hour)
+	duration -= days * 24 * time.Hour
+
+	value := "P"
+	if days > 0 {
+		value += fmt.Sprintf("%dD", days)
+	}
+
+	if duration > 0 {
+		value += "T"
+		for _, unit := range []struct {
+			duration time.Duration
+			suffix   string
+		}{{time.Hour, "H"}, {time.Minute, "M"}, {time.Second, "S"}} {
+			if amount := duration / unit.duration; amount > 0 {
+				value += fmt.Sprintf("%d%s", amount, unit.suffix)
+				duration -= amount * unit.duration
+			}
+		}
+	}
+
+	if value == "P" {
+		return "PT0S"
+	}
+
+	return value
+}
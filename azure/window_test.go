@@ -0,0 +1,81 @@
+package azure
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestGetTimes(t *testing.T) {
+
+	now := time.Date(2020, 5, 4, 10, 17, 42, 0, time.UTC)
+
+	type testGetTimes struct {
+		window MetricWindow
+		start  string
+		end    string
+	}
+	conditions := []testGetTimes{
+		{MetricWindow{}, "2020-05-04T10:16:00Z", "2020-05-04T10:17:00Z"},
+		{MetricWindow{Interval: time.Minute, Offset: 3 * time.Minute}, "2020-05-04T10:13:00Z", "2020-05-04T10:14:00Z"},
+		{MetricWindow{Interval: 5 * time.Minute, Offset: 3 * time.Minute}, "2020-05-04T10:05:00Z", "2020-05-04T10:10:00Z"},
+		{MetricWindow{Timespan: 15 * time.Minute, Interval: 5 * time.Minute, Offset: 3 * time.Minute}, "2020-05-04T09:55:00Z", "2020-05-04T10:10:00Z"},
+		{MetricWindow{Interval: time.Hour, Offset: 3 * time.Minute}, "2020-05-04T09:00:00Z", "2020-05-04T10:00:00Z"},
+		{MetricWindow{Interval: 24 * time.Hour}, "2020-05-03T00:00:00Z", "2020-05-04T00:00:00Z"},
+	}
+
+	for _, condition := range conditions {
+		end, start := getTimes(condition.window, now)
+		if start != condition.start || end != condition.end {
+			t.Errorf(errorMessageData, condition.start+"/"+condition.end, start+"/"+end)
+		}
+	}
+}
+
+func TestISODuration(t *testing.T) {
+
+	conditions := map[string]time.Duration{
+		"PT1M":    time.Minute,
+		"PT5M":    5 * time.Minute,
+		"PT1H":    time.Hour,
+		"PT1H30M": 90 * time.Minute,
+		"P1D":     24 * time.Hour,
+		"P1DT6H":  30 * time.Hour,
+	}
+
+	for value, expected := range conditions {
+		duration, err := parseISODuration(value)
+		if err != nil || duration != expected {
+			t.Errorf(errorMessageData, expected, duration)
+		}
+		if formatted := formatISODuration(expected); formatted != value {
+			t.Errorf(errorMessageData, value, formatted)
+		}
+	}
+
+	for _, value := range []string{"", "P", "PT", "1M", "PT1.5M", "P1W"} {
+		if _, err := parseISODuration(value); err == nil {
+			t.Errorf(errorMessageData, "error", value)
+		}
+	}
+}
+
+func TestSmallestTimeGrain(t *testing.T) {
+
+	var definitions MetricDefinitionResponse
+	err := json.Unmarshal([]byte(`{"value":[
+		{"name":{"value":"Requests"},"metricAvailabilities":[{"timeGrain":"PT1H"},{"timeGrain":"PT5M"},{"timeGrain":"P1D"}]},
+		{"name":{"value":"UsedCapacity"},"metricAvailabilities":[{"timeGrain":"PT1H"}]},
+		{"name":{"value":"CpuTime"}}
+	]}`), &definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []time.Duration{5 * time.Minute, time.Hour, 0}
+	for index, definition := range definitions.MetricDefinitionResponses {
+		if grain := definition.SmallestTimeGrain(); grain != expected[index] {
+			t.Errorf(errorMessageData, expected[index], grain)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package azure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// workloadIdentityCredential exchanges the service account token projected by Kubernetes
+// as a client assertion, following Azure AD workload identity federation.
+type workloadIdentityCredential struct {
+	client        *http.Client
+	authorityHost string
+	tenantID      string
+	clientID      string
+	tokenFile     string
+
+	mutex     sync.Mutex
+	assertion string
+	modTime   time.Time
+}
+
+func newWorkloadIdentityCredential(authorityHost, tenantID, clientID, tokenFile string) (*workloadIdentityCredential, error) {
+	if tenantID == "" || clientID == "" || tokenFile == "" {
+		return nil, fmt.Errorf("Workload identity requires tenantId, clientId and AZURE_FEDERATED_TOKEN_FILE")
+	}
+
+	return &workloadIdentityCredential{
+		client:        &http.Client{},
+		authorityHost: authorityHost,
+		tenantID:      tenantID,
+		clientID:      clientID,
+		tokenFile:     tokenFile,
+	}, nil
+}
+
+// GetToken requests a token for the audience using the federated service account token
+func (c *workloadIdentityCredential) GetToken(audience string) (Token, error) {
+
+	assertion, err := c.readAssertion()
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetAccessToken] - Error reading %s", c.tokenFile), err)
+		return Token{}, err
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {c.clientID},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}
+
+	return requestToken(c.client, c.authorityHost, c.tenantID, audience, form)
+}
+
+// readAssertion returns the federated token, reading the file again whenever kubelet rotates it
+func (c *workloadIdentityCredential) readAssertion() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	info, err := os.Stat(c.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("Error reading federated token file: %v", err)
+	}
+
+	if c.assertion != "" && info.ModTime().Equal(c.modTime) {
+		return c.assertion, nil
+	}
+
+	content, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("Error reading federated token file: %v", err)
+	}
+
+	assertion := strings.TrimSpace(string(content))
+	if assertion == "" {
+		return "", fmt.Errorf("Federated token file %s is empty", c.tokenFile)
+	}
+
+	c.assertion = assertion
+	c.modTime = info.ModTime()
+
+	return c.assertion, nil
+}
@@ -0,0 +1,124 @@
+package azure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFederatedToken(t *testing.T, path, token string, modTime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkloadIdentityCredentialPostsAssertion(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "workload-identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "azure-identity-token")
+	writeFederatedToken(t, path, "service-account-token", time.Now())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" ||
+			r.FormValue("grant_type") != "client_credentials" ||
+			r.FormValue("client_id") != "client" ||
+			r.FormValue("client_assertion_type") != clientAssertionType ||
+			r.FormValue("client_assertion") != "service-account-token" ||
+			r.FormValue("scope") != "https://management.azure.com/.default" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"token"}`))
+	}))
+	defer server.Close()
+
+	credential, err := newWorkloadIdentityCredential(server.URL, "tenant", "client", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential.client = server.Client()
+
+	token, err := credential.GetToken("https://management.azure.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "token" {
+		t.Errorf(errorMessageData, "token", token.AccessToken)
+	}
+}
+
+func TestWorkloadIdentityCredentialRereadsRotatedToken(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "workload-identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "azure-identity-token")
+	modTime := time.Now().Add(-time.Hour)
+	writeFederatedToken(t, path, "first", modTime)
+
+	credential, err := newWorkloadIdentityCredential(PublicCloud.AuthorityHost, "tenant", "client", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := []struct {
+		token       string
+		modTime     time.Time
+		expectative string
+	}{
+		{"first", modTime, "first"},
+		// the file is only read again once kubelet has rotated it
+		{"second", modTime, "first"},
+		{"second", modTime.Add(time.Minute), "second"},
+	}
+
+	for _, condition := range conditions {
+		writeFederatedToken(t, path, condition.token, condition.modTime)
+
+		assertion, err := credential.readAssertion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assertion != condition.expectative {
+			t.Errorf(errorMessageData, condition.expectative, assertion)
+		}
+	}
+
+	writeFederatedToken(t, path, "", modTime.Add(2*time.Minute))
+	if _, err := credential.readAssertion(); err == nil {
+		t.Errorf(errorMessageData, "error", "empty federated token file")
+	}
+}
+
+func TestNewWorkloadIdentityCredentialInvalidScenarios(t *testing.T) {
+
+	conditions := [][3]string{
+		{"", "client", "/var/run/secrets/azure/tokens/azure-identity-token"},
+		{"tenant", "", "/var/run/secrets/azure/tokens/azure-identity-token"},
+		{"tenant", "client", ""},
+	}
+
+	for _, condition := range conditions {
+		_, err := newWorkloadIdentityCredential(PublicCloud.AuthorityHost, condition[0], condition[1], condition[2])
+		if err == nil {
+			t.Errorf(errorMessageData, "error", fmt.Sprint(condition))
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/elk-logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheRefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_exporter_discovery_cache_refresh_failures_total",
+		Help: "Number of background refreshes of the discovery cache that failed.",
+	}, []string{"cache"})
+
+	cacheAgeDesc       = prometheus.NewDesc("azure_exporter_discovery_cache_age_seconds", "Age of the oldest entry of the discovery cache.", []string{"cache"}, nil)
+	cacheEntriesDesc   = prometheus.NewDesc("azure_exporter_discovery_cache_entries", "Number of entries in the discovery cache.", []string{"cache"}, nil)
+	cacheResourcesDesc = prometheus.NewDesc("azure_exporter_discovery_cache_resources", "Number of items held by the entries of the discovery cache.", []string{"cache"}, nil)
+
+	discovery = newDiscoveryCache(0)
+)
+
+func init() {
+	prometheus.MustRegister(cacheRefreshFailures)
+	prometheus.MustRegister(cacheCollector{})
+}
+
+// discoveryCache holds the resource lists and metric definitions discovered in Azure. Scrapes read
+// the cached values, which are refreshed in the background once they are older than the TTL, by
+// run or by the scrape reading them. The last good value is served while a refresh fails. A zero
+// TTL disables the cache.
+type discoveryCache struct {
+	ttl time.Duration
+
+	mutex     sync.Mutex
+	entries   map[string]*cacheEntry
+	lastSweep time.Time
+}
+
+type cacheEntry struct {
+	cache      string
+	value      interface{}
+	size       int
+	err        error
+	fetched    time.Time
+	used       time.Time
+	loaded     chan struct{}
+	refreshing bool
+	load       cacheLoader
+}
+
+// cacheLoader fetches the value of an entry and the number of items it holds
+type cacheLoader func() (interface{}, int, error)
+
+func newDiscoveryCache(ttl time.Duration) *discoveryCache {
+	return &discoveryCache{ttl: ttl, entries: make(map[string]*cacheEntry)}
+}
+
+// Get returns the cached value of the key, loading it on first use. Concurrent first uses wait
+// for the same load.
+func (c *discoveryCache) Get(cache, key string, load cacheLoader) (interface{}, error) {
+
+	if c.ttl <= 0 {
+		value, _, err := load()
+		return value, err
+	}
+
+	key = cache + "/" + key
+
+	c.mutex.Lock()
+	c.sweep()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cacheEntry{cache: cache, used: time.Now(), loaded: make(chan struct{}), load: load}
+		c.entries[key] = entry
+		c.mutex.Unlock()
+
+		value, size, err := load()
+
+		c.mutex.Lock()
+		if err != nil {
+			delete(c.entries, key)
+			entry.err = err
+		} else {
+			entry.value, entry.size, entry.fetched = value, size, time.Now()
+		}
+		close(entry.loaded)
+		c.mutex.Unlock()
+
+		return value, err
+	}
+
+	entry.used = time.Now()
+	entry.load = load
+	c.mutex.Unlock()
+
+	<-entry.loaded
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+
+	if time.Since(entry.fetched) >= c.ttl && !entry.refreshing {
+		entry.refreshing = true
+		go c.refresh(key, entry, load)
+	}
+
+	return entry.value, nil
+}
+
+// run refreshes the expired entries every interval until stop is closed, so that scrapes following
+// a quiet period are not served values older than the TTL
+func (c *discoveryCache) run(interval time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.refreshExpired()
+		}
+	}
+}
+
+// refreshExpired starts the refresh of every entry older than the TTL with its last loader
+func (c *discoveryCache) refreshExpired() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sweep()
+
+	for key, entry := range c.entries {
+		if entry.fetched.IsZero() || entry.refreshing || time.Since(entry.fetched) < c.ttl {
+			continue
+		}
+		entry.refreshing = true
+		go c.refresh(key, entry, entry.load)
+	}
+}
+
+// refresh loads the entry again, keeping the previous value on failure
+func (c *discoveryCache) refresh(key string, entry *cacheEntry, load cacheLoader) {
+
+	value, size, err := load()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry.refreshing = false
+
+	if err != nil {
+		cacheRefreshFailures.WithLabelValues(entry.cache).Inc()
+		logger.Error(fmt.Sprintf("Failed to refresh %s, serving the value fetched at %s: %v", key, entry.fetched.Format(time.RFC3339), err))
+		return
+	}
+
+	entry.value, entry.size, entry.fetched = value, size, time.Now()
+}
+
+// sweep drops the entries not used for two TTLs, such as definitions of deleted resources.
+// It must be called with the mutex held.
+func (c *discoveryCache) sweep() {
+
+	if time.Since(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = time.Now()
+
+	for key, entry := range c.entries {
+		if time.Since(entry.used) > 2*c.ttl && !entry.refreshing {
+			delete(c.entries, key)
+		}
+	}
+}
+
+type cacheCollector struct{}
+
+// Describe sends the descriptors of the discovery cache metrics
+func (cc cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheAgeDesc
+	ch <- cacheEntriesDesc
+	ch <- cacheResourcesDesc
+}
+
+// Collect sends the age, entries and items of each cache
+func (cc cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c := discovery
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	ages := make(map[string]float64)
+	entries := make(map[string]int)
+	sizes := make(map[string]int)
+
+	for _, entry := range c.entries {
+		if entry.fetched.IsZero() {
+			continue
+		}
+		if age := now.Sub(entry.fetched).Seconds(); age > ages[entry.cache] {
+			ages[entry.cache] = age
+		}
+		entries[entry.cache]++
+		sizes[entry.cache] += entry.size
+	}
+
+	for cache := range entries {
+		ch <- prometheus.MustNewConstMetric(cacheAgeDesc, prometheus.GaugeValue, ages[cache], cache)
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(entries[cache]), cache)
+		ch <- prometheus.MustNewConstMetric(cacheResourcesDesc, prometheus.GaugeValue, float64(sizes[cache]), cache)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDiscoveryCacheServesLastGoodValue(t *testing.T) {
+
+	cache := newDiscoveryCache(time.Hour)
+
+	loads := 0
+	load := func() (interface{}, int, error) {
+		loads++
+		if loads == 2 {
+			return nil, 0, fmt.Errorf("throttled")
+		}
+		return loads, 1, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		value, err := cache.Get("resources", "subscription", load)
+		if err != nil || value.(int) != 1 {
+			t.Errorf(errorMessageData, "1", value)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf(errorMessageQuantity, "1", fmt.Sprint(loads))
+	}
+
+	cache.entries["resources/subscription"].fetched = time.Now().Add(-2 * time.Hour)
+
+	// the stale value is served while the refresh fails in the background
+	value, _ := cache.Get("resources", "subscription", load)
+	if value.(int) != 1 {
+		t.Errorf(errorMessageData, "1", value)
+	}
+	waitRefresh(cache, "resources/subscription")
+
+	value, _ = cache.Get("resources", "subscription", load)
+	if value.(int) != 1 {
+		t.Errorf(errorMessageData, "1", value)
+	}
+	waitRefresh(cache, "resources/subscription")
+
+	value, _ = cache.Get("resources", "subscription", load)
+	if value.(int) != 3 {
+		t.Errorf(errorMessageData, "3", value)
+	}
+}
+
+func TestDiscoveryCacheDoesNotKeepFailedLoads(t *testing.T) {
+
+	cache := newDiscoveryCache(time.Hour)
+
+	_, err := cache.Get("definitions", "resource", func() (interface{}, int, error) {
+		return nil, 0, fmt.Errorf("forbidden")
+	})
+	if err == nil {
+		t.Errorf(errorMessageData, "error", "nil")
+	}
+
+	value, err := cache.Get("definitions", "resource", func() (interface{}, int, error) {
+		return "definitions", 1, nil
+	})
+	if err != nil || value.(string) != "definitions" {
+		t.Errorf(errorMessageData, "definitions", value)
+	}
+}
+
+func TestDiscoveryCacheRefreshesExpiredEntries(t *testing.T) {
+
+	cache := newDiscoveryCache(time.Hour)
+
+	loads := 0
+	load := func() (interface{}, int, error) {
+		loads++
+		return loads, 1, nil
+	}
+
+	cache.Get("resources", "subscription", load)
+	cache.refreshExpired()
+	waitRefresh(cache, "resources/subscription")
+
+	if loads != 1 {
+		t.Errorf(errorMessageQuantity, "1", fmt.Sprint(loads))
+	}
+
+	// Expired entries are refreshed without waiting for a scrape to read them
+	cache.mutex.Lock()
+	cache.entries["resources/subscription"].fetched = time.Now().Add(-2 * time.Hour)
+	cache.mutex.Unlock()
+
+	cache.refreshExpired()
+	waitRefresh(cache, "resources/subscription")
+
+	if loads != 2 {
+		t.Errorf(errorMessageQuantity, "2", fmt.Sprint(loads))
+	}
+
+	value, _ := cache.Get("resources", "subscription", load)
+	if value.(int) != 2 {
+		t.Errorf(errorMessageData, "2", fmt.Sprint(value))
+	}
+}
+
+func waitRefresh(cache *discoveryCache, key string) {
+	for i := 0; i < 100; i++ {
+		cache.mutex.Lock()
+		refreshing := cache.entries[key].refreshing
+		cache.mutex.Unlock()
+		if !refreshing {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultCredential = "default"
+
+// defaultManagementGroupRefresh is how often the subscriptions of a management group are listed again
+const defaultManagementGroupRefresh = time.Hour
+
+// defaultMetricOffset is how long Azure Monitor takes to ingest a metric value
+const defaultMetricOffset = 3 * time.Minute
+
+// Config represents the configuration file of the exporter
+type Config struct {
+	Credentials map[string]azure.CredentialConfig `yaml:"credentials"`
+	Targets     []Target                          `yaml:"targets"`
+	TagLabels   []TagLabel                        `yaml:"tagLabels"`
+
+	// SupportedResourceTypes and UnsupportedResourceTypes override the detection of the resource
+	// types supporting metrics
+	SupportedResourceTypes   []string `yaml:"supportedResourceTypes"`
+	UnsupportedResourceTypes []string `yaml:"unsupportedResourceTypes"`
+
+	// ChildResources are the nested resource types listed below their parents
+	ChildResources []azure.ChildResourceType `yaml:"childResources"`
+
+	// MetricDimensions are the metrics split into one series per combination of their dimensions
+	MetricDimensions []azure.MetricDimension `yaml:"metricDimensions"`
+
+	// MetricAggregations override the aggregations requested for metrics, the first matching entry
+	// applying
+	MetricAggregations []MetricAggregation `yaml:"metricAggregations"`
+
+	// MetricWindows override the timespan, interval and offset of the metric queries, each field
+	// taken from the first matching entry setting it
+	MetricWindows []MetricWindow `yaml:"metricWindows"`
+}
+
+// MetricAggregation selects the aggregations of a metric, of every metric of a resource type when
+// the metric is empty, or of the metric on every resource type when the resource type is empty
+type MetricAggregation struct {
+	ResourceType string   `yaml:"resourceType"`
+	Metric       string   `yaml:"metric"`
+	Aggregations []string `yaml:"aggregations"`
+}
+
+// MetricWindow sets the query window of a metric, of every metric of a resource type when the
+// metric is empty, of the metric on every resource type when the resource type is empty, or of
+// every metric when both are empty. Unset fields are taken from the next matching entry. Offset is
+// a pointer so that an offset of zero can be set.
+type MetricWindow struct {
+	ResourceType string         `yaml:"resourceType"`
+	Metric       string         `yaml:"metric"`
+	Timespan     time.Duration  `yaml:"timespan"`
+	Interval     time.Duration  `yaml:"interval"`
+	Offset       *time.Duration `yaml:"offset"`
+}
+
+// TagLabel adds the value of a resource tag to every series of the resource. The label is named
+// after the tag unless renamed, and takes the default value when the resource lacks the tag.
+type TagLabel struct {
+	Tag     string `yaml:"tag"`
+	Label   string `yaml:"label"`
+	Default string `yaml:"default"`
+}
+
+// reservedLabels are the labels set on every series by the exporter
+var reservedLabels = []string{"resource_group", "resource_type", "resource_name", "resource_environment", "resource_project_name", "subscription_id", "subscription_name", "management_group", "parent_resource"}
+
+var labelNameRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// Target binds subscriptions to the credential profile used to scrape them. The subscriptions
+// are either listed, every subscription accessible with the credential when allSubscriptions
+// is set, or every subscription below managementGroup, narrowed by the include and exclude
+// patterns on subscription ID or name. Resources are listed per subscription, per resource group
+// when resourceGroups is set, or selected across the subscriptions by resourceGraphQuery, and
+// narrowed by the filter.
+type Target struct {
+	Name                   string               `yaml:"name"`
+	Credential             string               `yaml:"credential"`
+	SubscriptionID         azure.Secret         `yaml:"subscriptionId"`
+	Subscriptions          []string             `yaml:"subscriptions"`
+	AllSubscriptions       bool                 `yaml:"allSubscriptions"`
+	ManagementGroup        string               `yaml:"managementGroup"`
+	ManagementGroupRefresh time.Duration        `yaml:"managementGroupRefresh"`
+	ResourceGraphQuery     string               `yaml:"resourceGraphQuery"`
+	Filter                 azure.ResourceFilter `yaml:"filter"`
+	ResourceGroups         []string             `yaml:"resourceGroups"`
+	IncludeSubscriptions   []string             `yaml:"includeSubscriptions"`
+	ExcludeSubscriptions   []string             `yaml:"excludeSubscriptions"`
+
+	include               []*regexp.Regexp
+	exclude               []*regexp.Regexp
+	resourceGroupNames    []string
+	resourceGroupPatterns []*regexp.Regexp
+}
+
+// LoadConfig reads the configuration file. Without a file, a single default profile and
+// target are taken from the environment variables.
+func LoadConfig(path string) (Config, error) {
+
+	if path == "" {
+		managementGroupRefresh, err := parseDuration(os.Getenv("managementGroupRefresh"))
+		if err != nil {
+			return Config{}, fmt.Errorf("Error parsing managementGroupRefresh: %v", err)
+		}
+
+		metricWindow, err := metricWindowFromEnv()
+		if err != nil {
+			return Config{}, err
+		}
+
+		config := Config{
+			Credentials: map[string]azure.CredentialConfig{
+				defaultCredential: azure.CredentialConfigFromEnv(),
+			},
+			Targets: []Target{
+				{
+					Name:                   defaultCredential,
+					Credential:             defaultCredential,
+					SubscriptionID:         azure.SecretFromEnv("subscriptionId"),
+					AllSubscriptions:       os.Getenv("allSubscriptions") == "true",
+					ManagementGroup:        os.Getenv("managementGroup"),
+					ManagementGroupRefresh: managementGroupRefresh,
+					ResourceGraphQuery:     os.Getenv("resourceGraphQuery"),
+					ResourceGroups:         splitList(os.Getenv("resourceGroups")),
+					IncludeSubscriptions:   splitList(os.Getenv("includeSubscriptions")),
+					ExcludeSubscriptions:   splitList(os.Getenv("excludeSubscriptions")),
+				},
+			},
+			TagLabels:                tagLabelsFromEnv(os.Getenv("tagLabels")),
+			SupportedResourceTypes:   splitList(os.Getenv("supportedResourceTypes")),
+			UnsupportedResourceTypes: splitList(os.Getenv("unsupportedResourceTypes")),
+			ChildResources:           childResourcesFromEnv(os.Getenv("childResources")),
+			MetricWindows:            []MetricWindow{metricWindow},
+		}
+
+		err = config.validate()
+		if err != nil {
+			return Config{}, err
+		}
+
+		return config, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("Error reading config file: %v", err)
+	}
+
+	var config Config
+	err = yaml.UnmarshalStrict(content, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("Error parsing config file: %v", err)
+	}
+
+	err = config.validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+func (config *Config) validate() error {
+
+	if len(config.Credentials) == 0 {
+		return fmt.Errorf("No credentials defined in config file")
+	}
+
+	err := config.validateTagLabels()
+	if err != nil {
+		return err
+	}
+
+	for index, dimension := range config.MetricDimensions {
+		if dimension.Metric == "" || dimension.Filter == "" {
+			return fmt.Errorf("Metric dimension %d needs a metric and a filter", index)
+		}
+	}
+
+	for index, aggregation := range config.MetricAggregations {
+		if aggregation.ResourceType == "" && aggregation.Metric == "" {
+			return fmt.Errorf("Metric aggregation %d needs a resourceType or a metric", index)
+		}
+		if len(aggregation.Aggregations) == 0 {
+			return fmt.Errorf("Metric aggregation %d has no aggregations", index)
+		}
+		for _, name := range aggregation.Aggregations {
+			if !azure.IsAggregation(name) {
+				return fmt.Errorf("Metric aggregation %d has unknown aggregation %s", index, name)
+			}
+		}
+	}
+
+	for index, window := range config.MetricWindows {
+		if window.Timespan < 0 || window.Interval < 0 || (window.Offset != nil && *window.Offset < 0) {
+			return fmt.Errorf("Metric window %d has a negative duration", index)
+		}
+		if window.Interval > 0 && !azure.IsTimeGrain(window.Interval) {
+			return fmt.Errorf("Metric window %d has interval %s, which is not one of 1m, 5m, 15m, 30m, 1h, 6h, 12h or 24h", index, window.Interval)
+		}
+		if window.Timespan > 0 && window.Timespan < window.Interval {
+			return fmt.Errorf("Metric window %d has a timespan shorter than its interval", index)
+		}
+	}
+
+	for index := range config.ChildResources {
+		err = config.ChildResources[index].Complete()
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool)
+	for index := range config.Targets {
+		target := &config.Targets[index]
+
+		if target.SubscriptionID.IsEmpty() && len(target.Subscriptions) == 0 && !target.AllSubscriptions && target.ManagementGroup == "" {
+			return fmt.Errorf("Target %d has no subscriptionId, subscriptions, allSubscriptions or managementGroup", index)
+		}
+
+		if target.AllSubscriptions && target.ManagementGroup != "" {
+			return fmt.Errorf("Target %d sets both allSubscriptions and managementGroup", index)
+		}
+
+		if target.ManagementGroupRefresh <= 0 {
+			target.ManagementGroupRefresh = defaultManagementGroupRefresh
+		}
+
+		if target.Credential == "" {
+			target.Credential = defaultCredential
+		}
+
+		if target.Name == "" {
+			switch {
+			case !target.SubscriptionID.IsEmpty() || len(target.Subscriptions) > 0:
+				value, err := target.SubscriptionID.Value()
+				if err != nil {
+					return fmt.Errorf("Target %d: Error reading subscriptionId: %v", index, err)
+				}
+				target.Name = strings.Join(append(splitList(value), target.Subscriptions...), ",")
+			case target.ManagementGroup != "":
+				target.Name = target.ManagementGroup
+			default:
+				target.Name = target.Credential
+			}
+		}
+
+		if names[target.Name] {
+			return fmt.Errorf("Target %s is defined more than once", target.Name)
+		}
+		names[target.Name] = true
+
+		if _, ok := config.Credentials[target.Credential]; !ok {
+			return fmt.Errorf("Target %s uses unknown credential %s", target.Name, target.Credential)
+		}
+
+		err = target.Filter.Compile()
+		if err != nil {
+			return fmt.Errorf("Target %s has an invalid filter: %v", target.Name, err)
+		}
+
+		target.include, err = compilePatterns(target.IncludeSubscriptions)
+		if err != nil {
+			return fmt.Errorf("Target %s has an invalid includeSubscriptions pattern: %v", target.Name, err)
+		}
+
+		target.exclude, err = compilePatterns(target.ExcludeSubscriptions)
+		if err != nil {
+			return fmt.Errorf("Target %s has an invalid excludeSubscriptions pattern: %v", target.Name, err)
+		}
+
+		if len(target.ResourceGroups) > 0 && target.ResourceGraphQuery != "" {
+			return fmt.Errorf("Target %s sets both resourceGroups and resourceGraphQuery, select resource groups in the query instead", target.Name)
+		}
+
+		err = target.compileResourceGroups()
+		if err != nil {
+			return fmt.Errorf("Target %s has an invalid resourceGroups pattern: %v", target.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// compileResourceGroups separates the resource group names, queried directly, from the wildcard
+// patterns, where "*" matches any characters and "?" a single character
+func (target *Target) compileResourceGroups() error {
+	target.resourceGroupNames = []string{}
+	target.resourceGroupPatterns = []*regexp.Regexp{}
+
+	for _, resourceGroup := range target.ResourceGroups {
+		if !strings.ContainsAny(resourceGroup, "*?") {
+			target.resourceGroupNames = append(target.resourceGroupNames, resourceGroup)
+			continue
+		}
+
+		expression, err := regexp.Compile("(?i)^" + wildcardPattern(resourceGroup) + "$")
+		if err != nil {
+			return err
+		}
+		target.resourceGroupPatterns = append(target.resourceGroupPatterns, expression)
+	}
+
+	return nil
+}
+
+// wildcardPattern converts the "*" and "?" wildcards of the value into a regular expression,
+// quoting the other characters
+func wildcardPattern(value string) string {
+	pattern := ""
+
+	for _, character := range value {
+		switch character {
+		case '*':
+			pattern += ".*"
+		case '?':
+			pattern += "."
+		default:
+			pattern += regexp.QuoteMeta(string(character))
+		}
+	}
+
+	return pattern
+}
+
+// compilePatterns compiles the patterns anchored to the whole value
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+
+	for _, pattern := range patterns {
+		expression, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, expression)
+	}
+
+	return compiled, nil
+}
+
+// parseDuration parses the duration, an empty value being zero
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// metricWindowFromEnv reads the query window of every metric from metricTimespan, metricInterval
+// and metricOffset
+func metricWindowFromEnv() (MetricWindow, error) {
+	var window MetricWindow
+	var err error
+
+	for _, field := range []struct {
+		name  string
+		value *time.Duration
+	}{{"metricTimespan", &window.Timespan}, {"metricInterval", &window.Interval}} {
+		*field.value, err = parseDuration(os.Getenv(field.name))
+		if err != nil {
+			return MetricWindow{}, fmt.Errorf("Error parsing %s: %v", field.name, err)
+		}
+	}
+
+	if value := os.Getenv("metricOffset"); value != "" {
+		offset, err := time.ParseDuration(value)
+		if err != nil {
+			return MetricWindow{}, fmt.Errorf("Error parsing metricOffset: %v", err)
+		}
+		window.Offset = &offset
+	}
+
+	return window, nil
+}
+
+// splitList splits a comma or newline separated list, dropping empty entries
+func splitList(list string) []string {
+	values := []string{}
+
+	for _, value := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' }) {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func (config *Config) validateTagLabels() error {
+
+	labels := make(map[string]bool)
+	for _, label := range reservedLabels {
+		labels[label] = true
+	}
+
+	for index := range config.TagLabels {
+		tagLabel := &config.TagLabels[index]
+
+		if tagLabel.Tag == "" {
+			return fmt.Errorf("Tag label %d has no tag", index)
+		}
+
+		if tagLabel.Label == "" {
+			tagLabel.Label = tagLabelName(tagLabel.Tag)
+		}
+
+		if !labelNameRegexp.MatchString(tagLabel.Label) {
+			return fmt.Errorf("Tag label %s of tag %s is not a valid label name", tagLabel.Label, tagLabel.Tag)
+		}
+
+		if labels[tagLabel.Label] {
+			return fmt.Errorf("Tag label %s is used more than once", tagLabel.Label)
+		}
+		labels[tagLabel.Label] = true
+	}
+
+	return nil
+}
+
+// tagLabelsFromEnv reads the tag labels from a list of tags, each optionally renamed with "tag=label"
+func tagLabelsFromEnv(list string) []TagLabel {
+	tagLabels := []TagLabel{}
+
+	for _, entry := range splitList(list) {
+		parts := strings.SplitN(entry, "=", 2)
+		tagLabel := TagLabel{Tag: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			tagLabel.Label = strings.TrimSpace(parts[1])
+		}
+		tagLabels = append(tagLabels, tagLabel)
+	}
+
+	return tagLabels
+}
+
+// childResourcesFromEnv reads the child resource types from a list of types, each optionally
+// followed by its API version as "type=apiVersion"
+func childResourcesFromEnv(list string) []azure.ChildResourceType {
+	childResources := []azure.ChildResourceType{}
+
+	for _, entry := range splitList(list) {
+		parts := strings.SplitN(entry, "=", 2)
+		childResource := azure.ChildResourceType{Type: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			childResource.APIVersion = strings.TrimSpace(parts[1])
+		}
+		childResources = append(childResources, childResource)
+	}
+
+	return childResources
+}
+
+// metricDimension returns the dimensions splitting the metric of the resource type, nil when the
+// metric is not split
+func (config *Config) metricDimension(resourceType, metric string) *azure.MetricDimension {
+	for index := range config.MetricDimensions {
+		if config.MetricDimensions[index].Matches(resourceType, metric) {
+			return &config.MetricDimensions[index]
+		}
+	}
+
+	return nil
+}
+
+// metricAggregation returns the aggregations configured for the metric of the resource type, nil
+// when none is configured
+func (config *Config) metricAggregation(resourceType, metric string) *MetricAggregation {
+	for index := range config.MetricAggregations {
+		aggregation := &config.MetricAggregations[index]
+		if (aggregation.ResourceType == "" || strings.EqualFold(aggregation.ResourceType, resourceType)) &&
+			(aggregation.Metric == "" || strings.EqualFold(aggregation.Metric, metric)) {
+			return aggregation
+		}
+	}
+
+	return nil
+}
+
+// metricWindow returns the query window of the metric of the resource type. The interval defaults
+// to grain, the smallest time grain of the metric, the timespan to the interval and the offset to
+// defaultMetricOffset, so the window holds the last complete time grain.
+func (config *Config) metricWindow(resourceType, metric string, grain time.Duration) azure.MetricWindow {
+	var window azure.MetricWindow
+	var offset *time.Duration
+
+	for _, override := range config.MetricWindows {
+		if (override.ResourceType != "" && !strings.EqualFold(override.ResourceType, resourceType)) ||
+			(override.Metric != "" && !strings.EqualFold(override.Metric, metric)) {
+			continue
+		}
+		if window.Timespan == 0 {
+			window.Timespan = override.Timespan
+		}
+		if window.Interval == 0 {
+			window.Interval = override.Interval
+		}
+		if offset == nil {
+			offset = override.Offset
+		}
+	}
+
+	if window.Interval == 0 {
+		window.Interval = grain
+	}
+	if window.Interval == 0 {
+		window.Interval = time.Minute
+	}
+	if window.Timespan < window.Interval {
+		window.Timespan = window.Interval
+	}
+	window.Offset = defaultMetricOffset
+	if offset != nil {
+		window.Offset = *offset
+	}
+
+	return window
+}
+
+// SelectTargets returns the targets bound to the credential profile and with the given name.
+// Empty values select every profile or every target.
+func (config *Config) SelectTargets(credential, name string) []Target {
+	targets := []Target{}
+
+	for _, target := range config.Targets {
+		if credential != "" && target.Credential != credential {
+			continue
+		}
+		if name != "" && target.Name != name {
+			continue
+		}
+		targets = append(targets, target)
+	}
+
+	return targets
+}
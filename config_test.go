@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+
+	return file.Name()
+}
+
+func TestLoadConfigValidScenarios(t *testing.T) {
+
+	path := writeTestConfig(t, `
+credentials:
+  default:
+    tenantId: tenant
+    clientId: client
+    clientSecret: secret
+  customer:
+    authMethod: managed_identity
+targets:
+  - subscriptionId: subscription-a
+  - name: customer
+    credential: customer
+    subscriptionId: subscription-b
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Targets) != 2 {
+		t.Fatalf(errorMessageQuantity, "2", fmt.Sprint(len(config.Targets)))
+	}
+
+	if config.Targets[0].Name != "subscription-a" || config.Targets[0].Credential != defaultCredential {
+		t.Errorf(errorMessageData, "subscription-a", fmt.Sprint(config.Targets[0]))
+	}
+
+	targets := config.SelectTargets("customer", "")
+	if len(targets) != 1 || targets[0].Name != "customer" {
+		t.Errorf(errorMessageData, "customer", fmt.Sprint(targets))
+	}
+
+	targets = config.SelectTargets("", "")
+	if len(targets) != 2 {
+		t.Errorf(errorMessageQuantity, "2", fmt.Sprint(len(targets)))
+	}
+}
+
+func TestLoadConfigInvalidScenarios(t *testing.T) {
+
+	conditions := [4]string{
+		"targets:\n  - subscriptionId: subscription-a\n",
+		"credentials:\n  default: {}\ntargets:\n  - name: without-subscription\n",
+		"credentials:\n  default: {}\ntargets:\n  - subscriptionId: subscription-a\n    credential: unknown\n",
+		"credentials:\n  default: {}\ntargets:\n  - subscriptionId: subscription-a\n  - subscriptionId: subscription-a\n",
+	}
+
+	for _, condition := range conditions {
+
+		path := writeTestConfig(t, condition)
+		_, err := LoadConfig(path)
+		os.Remove(path)
+
+		if err == nil {
+			t.Errorf(errorMessageData, "error", condition)
+		}
+	}
+}
+
+func TestLoadConfigSubscriptions(t *testing.T) {
+
+	path := writeTestConfig(t, `
+credentials:
+  default: {}
+targets:
+  - subscriptions: [subscription-a, subscription-b]
+  - allSubscriptions: true
+    includeSubscriptions: ['.*-prd']
+    excludeSubscriptions: [subscription-c]
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Targets[0].Name != "subscription-a,subscription-b" {
+		t.Errorf(errorMessageData, "subscription-a,subscription-b", config.Targets[0].Name)
+	}
+
+	target := config.Targets[1]
+	if target.Name != defaultCredential {
+		t.Errorf(errorMessageData, defaultCredential, target.Name)
+	}
+
+	conditions := map[azure.Subscription]bool{
+		{SubscriptionID: "subscription-a", DisplayName: "billing-prd"}: true,
+		{SubscriptionID: "subscription-b", DisplayName: "billing-dev"}: false,
+		{SubscriptionID: "subscription-c", DisplayName: "legacy-prd"}:  false,
+		{SubscriptionID: "subscription-prd"}:                           true,
+	}
+
+	for subscription, expected := range conditions {
+		if target.matchSubscription(subscription) != expected {
+			t.Errorf(errorMessageData, fmt.Sprint(expected), subscription)
+		}
+	}
+}
+
+func TestLoadConfigSubscriptionFileName(t *testing.T) {
+
+	subscriptions := writeTestConfig(t, "subscription-a\nsubscription-b\n")
+	defer os.Remove(subscriptions)
+
+	path := writeTestConfig(t, "credentials:\n  default: {}\ntargets:\n  - subscriptionId: file:"+subscriptions+"\n")
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Targets[0].Name != "subscription-a,subscription-b" {
+		t.Errorf(errorMessageData, "subscription-a,subscription-b", config.Targets[0].Name)
+	}
+}
+
+func TestLoadConfigInvalidSubscriptionPattern(t *testing.T) {
+
+	path := writeTestConfig(t, "credentials:\n  default: {}\ntargets:\n  - allSubscriptions: true\n    includeSubscriptions: ['(']\n")
+	defer os.Remove(path)
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf(errorMessageData, "error", "invalid pattern")
+	}
+}
+
+func TestSplitList(t *testing.T) {
+
+	values := splitList("subscription-a, subscription-b\nsubscription-c,,")
+	if len(values) != 3 || values[1] != "subscription-b" || values[2] != "subscription-c" {
+		t.Errorf(errorMessageData, "[subscription-a subscription-b subscription-c]", values)
+	}
+}
+
+func TestLoadConfigTagLabels(t *testing.T) {
+
+	path := writeTestConfig(t, `
+credentials:
+  default: {}
+targets:
+  - subscriptionId: subscription-a
+tagLabels:
+  - tag: cost-center
+  - tag: owner
+    label: team
+    default: unknown
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.TagLabels[0].Label != "tag_cost_center" || config.TagLabels[1].Label != "team" {
+		t.Errorf(errorMessageData, "tag_cost_center team", config.TagLabels)
+	}
+
+	conditions := []string{
+		"tagLabels:\n  - label: team\n",
+		"tagLabels:\n  - tag: owner\n    label: resource_group\n",
+		"tagLabels:\n  - tag: owner\n    label: team-owner\n",
+		"tagLabels:\n  - tag: cost-center\n  - tag: Cost_Center\n",
+	}
+
+	for _, condition := range conditions {
+
+		path := writeTestConfig(t, "credentials:\n  default: {}\ntargets:\n  - subscriptionId: subscription-a\n"+condition)
+		_, err := LoadConfig(path)
+		os.Remove(path)
+
+		if err == nil {
+			t.Errorf(errorMessageData, "error", condition)
+		}
+	}
+}
+
+func TestLoadConfigResourceGroups(t *testing.T) {
+
+	path := writeTestConfig(t, `
+credentials:
+  default: {}
+targets:
+  - subscriptionId: subscription-a
+    resourceGroups: [rg-payments, 'rg-checkout-*', rg.legacy(old), 'rg-?-eu']
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := config.Targets[0]
+	if len(target.resourceGroupNames) != 2 || target.resourceGroupNames[1] != "rg.legacy(old)" {
+		t.Errorf(errorMessageData, "[rg-payments rg.legacy(old)]", fmt.Sprint(target.resourceGroupNames))
+	}
+
+	if len(target.resourceGroupPatterns) != 2 {
+		t.Fatalf(errorMessageQuantity, "2", fmt.Sprint(len(target.resourceGroupPatterns)))
+	}
+
+	conditions := map[string]bool{
+		"RG-Checkout-prd": true,
+		"rg-checkout-":    true,
+		"rg-checkout":     false,
+		"rg-checkout--":   true,
+		"rg-a-eu":         true,
+		"rg-ab-eu":        false,
+		"rg-payments":     false,
+	}
+
+	for name, expected := range conditions {
+		matched := target.resourceGroupPatterns[0].MatchString(name) || target.resourceGroupPatterns[1].MatchString(name)
+		if matched != expected {
+			t.Errorf(errorMessageData, fmt.Sprint(expected), name)
+		}
+	}
+
+	path = writeTestConfig(t, "credentials:\n  default: {}\ntargets:\n  - subscriptionId: subscription-a\n    resourceGroups: [rg]\n    resourceGraphQuery: where type == 'x'\n")
+	defer os.Remove(path)
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf(errorMessageData, "error", "resourceGroups and resourceGraphQuery")
+	}
+}
+
+func TestLoadConfigMetricWindows(t *testing.T) {
+
+	path := writeTestConfig(t, `
+credentials:
+  default: {}
+targets:
+  - subscriptionId: subscription-a
+metricWindows:
+  - resourceType: Microsoft.Web/sites
+    metric: Requests
+    interval: 5m
+  - resourceType: Microsoft.Web/sites
+    timespan: 15m
+  - resourceType: Microsoft.Insights/components
+    offset: 0s
+  - offset: 4m
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	window := config.metricWindow("microsoft.web/sites", "requests", time.Minute)
+	if window.Timespan != 15*time.Minute || window.Interval != 5*time.Minute || window.Offset != 4*time.Minute {
+		t.Errorf(errorMessageData, "15m 5m 4m", window)
+	}
+
+	window = config.metricWindow("Microsoft.Web/sites", "CpuTime", 0)
+	if window.Timespan != 15*time.Minute || window.Interval != time.Minute || window.Offset != 4*time.Minute {
+		t.Errorf(errorMessageData, "15m 1m 4m", window)
+	}
+
+	window = config.metricWindow("Microsoft.Storage/storageAccounts", "UsedCapacity", time.Hour)
+	if window.Timespan != time.Hour || window.Interval != time.Hour || window.Offset != 4*time.Minute {
+		t.Errorf(errorMessageData, "1h 1h 4m", window)
+	}
+
+	window = config.metricWindow("Microsoft.Insights/components", "requests/count", time.Minute)
+	if window.Offset != 0 {
+		t.Errorf(errorMessageData, "0s", window.Offset.String())
+	}
+
+	window = (&Config{}).metricWindow("Microsoft.Insights/components", "requests/count", time.Minute)
+	if window.Offset != defaultMetricOffset {
+		t.Errorf(errorMessageData, defaultMetricOffset.String(), window.Offset.String())
+	}
+
+	conditions := []string{
+		"metricWindows:\n  - interval: 30s\n",
+		"metricWindows:\n  - interval: 90s\n",
+		"metricWindows:\n  - interval: 7m\n",
+		"metricWindows:\n  - interval: 2h\n",
+		"metricWindows:\n  - offset: -1m\n",
+		"metricWindows:\n  - timespan: 5m\n    interval: 15m\n",
+	}
+
+	for _, condition := range conditions {
+
+		path := writeTestConfig(t, "credentials:\n  default: {}\ntargets:\n  - subscriptionId: subscription-a\n"+condition)
+		_, err := LoadConfig(path)
+		os.Remove(path)
+
+		if err == nil {
+			t.Errorf(errorMessageData, "error", condition)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// resourceInfoLabels are the labels of azure_resource_info besides the tags of the resources
+var resourceInfoLabels = []string{"resource_id", "resource_name", "resource_type", "resource_group", "subscription_id", "subscription_name", "management_group", "location", "kind", "sku_name", "sku_tier", "managed_by", "parent_resource"}
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// resourceInfo is a resource discovered during the scrape, reported by azure_resource_info
+type resourceInfo struct {
+	subscription azure.Subscription
+	resource     azure.Resource
+}
+
+// collectResourceInfo sends one azure_resource_info series per resource. Tags become tag_ labels,
+// and every series carries the tag labels of all the resources so the label set stays the same.
+func collectResourceInfo(ch chan<- prometheus.Metric, resources []resourceInfo) {
+
+	if len(resources) == 0 {
+		return
+	}
+
+	tagLabels := make(map[string]bool)
+	for _, info := range resources {
+		for name := range info.resource.Tags {
+			tagLabels[tagLabelName(name)] = true
+		}
+	}
+
+	labelNames := append([]string{}, resourceInfoLabels...)
+	tagNames := []string{}
+	for name := range tagLabels {
+		tagNames = append(tagNames, name)
+	}
+	sort.Strings(tagNames)
+	labelNames = append(labelNames, tagNames...)
+
+	desc := prometheus.NewDesc("azure_resource_info", "Information about the resources discovered in Azure, to be joined on subscription_id, resource_group and resource_name.", labelNames, nil)
+
+	seen := make(map[string]bool)
+	for _, info := range resources {
+		resource := info.resource
+
+		if seen[strings.ToLower(resource.ID)] {
+			continue
+		}
+		seen[strings.ToLower(resource.ID)] = true
+
+		skuName, skuTier := "", ""
+		if resource.SKU != nil {
+			skuName, skuTier = resource.SKU.Name, resource.SKU.Tier
+		}
+
+		values := []string{resource.ID, resource.Name, resource.Type, azure.ResourceGroupOf(resource.ID), info.subscription.SubscriptionID, info.subscription.DisplayName, info.subscription.ManagementGroup, resource.Location, resource.Kind, skuName, skuTier, resource.ManagedBy, resource.Parent}
+
+		tags := make(map[string]string)
+		for name, value := range resource.Tags {
+			if _, ok := tags[tagLabelName(name)]; !ok {
+				tags[tagLabelName(name)] = value
+			}
+		}
+		for _, name := range tagNames {
+			values = append(values, tags[name])
+		}
+
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+	}
+}
+
+// tagLabelName returns the label name of the tag, replacing the characters not allowed in labels
+func tagLabelName(tag string) string {
+	return "tag_" + invalidLabelChars.ReplaceAllString(strings.ToLower(tag), "_")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollectResourceInfo(t *testing.T) {
+
+	subscription := azure.Subscription{SubscriptionID: "subscription-a", DisplayName: "payments-prd", ManagementGroup: "production"}
+	resources := []resourceInfo{
+		{subscription, azure.Resource{
+			ID:       "/subscriptions/subscription-a/resourceGroups/rg/providers/Microsoft.Web/sites/a",
+			Name:     "a",
+			Location: "brazilsouth",
+			SKU:      &azure.ResourceSKU{Name: "P1v2", Tier: "PremiumV2"},
+			Tags:     map[string]string{"Cost-Center": "42"},
+		}},
+		{subscription, azure.Resource{
+			ID:   "/subscriptions/subscription-a/resourceGroups/rg/providers/Microsoft.Web/sites/b",
+			Name: "b",
+			Tags: map[string]string{"team": "payments"},
+		}},
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	collectResourceInfo(ch, resources)
+	close(ch)
+
+	metrics := []map[string]string{}
+	for metric := range ch {
+		var m dto.Metric
+		metric.Write(&m)
+		labels := make(map[string]string)
+		for _, label := range m.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		metrics = append(metrics, labels)
+	}
+
+	if len(metrics) != 2 {
+		t.Fatalf(errorMessageQuantity, "2", fmt.Sprint(len(metrics)))
+	}
+
+	if len(metrics[0]) != len(metrics[1]) {
+		t.Errorf(errorMessageData, metrics[0], metrics[1])
+	}
+
+	if metrics[0]["tag_cost_center"] != "42" || metrics[0]["sku_name"] != "P1v2" || metrics[0]["resource_group"] != "rg" || metrics[0]["location"] != "brazilsouth" {
+		t.Errorf(errorMessageData, "tag_cost_center=42", metrics[0])
+	}
+
+	if metrics[0]["subscription_name"] != "payments-prd" || metrics[0]["management_group"] != "production" {
+		t.Errorf(errorMessageData, "subscription_name=payments-prd", metrics[0])
+	}
+
+	if _, ok := metrics[1]["tag_cost_center"]; !ok || metrics[1]["tag_team"] != "payments" {
+		t.Errorf(errorMessageData, "tag_team=payments", metrics[1])
+	}
+}
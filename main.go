@@ -5,7 +5,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"regexp"
 	"runtime/debug"
+	"strings"
 
 	"github.com/dasa-health/azure_metrics_exporter/azure"
 	"github.com/dasa-health/elk-logger"
@@ -19,6 +21,11 @@ import (
 
 var (
 	listenAddress = kingpin.Flag("web.listen-address", "The address to listen on for HTTP requests.").Default(":9276").String()
+	configFile    = kingpin.Flag("config.file", "Azure exporter configuration file. Credentials are read from environment variables when empty.").Default("").String()
+	cacheTTL      = kingpin.Flag("discovery.cache-ttl", "How long discovered resources and metric definitions are served before being refreshed in the background. 0 disables the cache.").Default("5m").Duration()
+	config        Config
+
+	upDesc = prometheus.NewDesc("azure_up", "Whether the target could be authenticated and the resources of all its subscriptions listed.", []string{"target"}, nil)
 )
 
 func init() {
@@ -28,7 +35,11 @@ func init() {
 
 // Collector generic collector type
 type Collector struct {
-	tagValue string
+	tagValue  string
+	filter    azure.ResourceFilter
+	targets   []Target
+	resources []resourceInfo
+	collected map[string]bool
 }
 
 // Describe implemented with dummy data to satisfy interface.
@@ -39,106 +50,304 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 // Collect - collect results from Azure Montior API and create Prometheus metrics.
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	resourceAggregation := os.Getenv("metricAggregation")
+	c.resources = nil
+	c.collected = make(map[string]bool)
+
+	if c.tagValue == "" && c.filter.IsEmpty() {
+		logger.Info("No tagValue or filter in the scrape, the resources are selected by the filters of the targets only")
+	}
+
+	for _, target := range c.targets {
+
+		logger.Info(fmt.Sprintf("Get all resources of target [ %s ]", target.Name))
+
+		ac, err := azure.GetClient(target.Credential, config.Credentials[target.Credential])
+
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get access token of credential %s, skipping target %s: %v", target.Credential, target.Name, err))
+			ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0, target.Name)
+			continue
+		}
+		subscriptions, err := target.ResolveSubscriptions(&ac)
+
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to resolve subscriptions of target %s: %v", target.Name, err))
+			ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0, target.Name)
+			continue
+		}
+
+		up := 1.0
+		if target.ResourceGraphQuery != "" {
+			up = c.collectResourceGraph(ch, &ac, target, subscriptions, resourceAggregation)
+		} else {
+			for _, subscription := range subscriptions {
+
+				if len(target.ResourceGroups) > 0 {
+					if c.collectResourceGroups(ch, &ac, target, subscription, resourceAggregation) == 0 {
+						up = 0
+					}
+					continue
+				}
+
+				logger.Info(fmt.Sprintf("Get all resources of subscription [ %s ]", subscription.SubscriptionID))
+
+				resources, err := c.getResources(&ac, target, subscription)
+
+				if err != nil {
+					logger.Error(fmt.Sprintf("Failed to get all resources of subscription %s in target %s: %v", subscription.SubscriptionID, target.Name, err))
+					up = 0
+					continue
+				}
+
+				for _, resource := range resources {
+					c.collectResource(ch, &ac, subscription, resource, resourceAggregation)
+				}
+			}
+		}
 
-	if c.tagValue == "" {
-		logger.Error("Tag value is empty")
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up, target.Name)
 	}
 
-	logger.Info("Get all resources")
+	collectResourceInfo(ch, c.resources)
 
-	ac, err := azure.GetAccessToken()
+	logger.Info("Finally Get all resources")
+
+}
+
+// filters returns the filters selecting the resources of the target: its own filter, the filter
+// of the scrape parameters and the resourceQueryTagName tag equal to the tagValue parameter
+func (c *Collector) filters(target Target) []azure.ResourceFilter {
+	filters := []azure.ResourceFilter{target.Filter, c.filter}
+
+	tagName := os.Getenv("resourceQueryTagName")
+	if tagName != "" && c.tagValue != "" {
+		filters = append(filters, azure.ResourceFilter{Tags: []string{tagName + "=" + regexp.QuoteMeta(c.tagValue)}})
+	}
+
+	return filters
+}
+
+// filtersKey identifies the filters in the discovery cache
+func filtersKey(filters []azure.ResourceFilter) string {
+	keys := []string{}
+	for index := range filters {
+		keys = append(keys, filters[index].String())
+	}
+
+	return strings.Join(keys, "|")
+}
+
+// getResources returns the resources of the subscription from the discovery cache
+func (c *Collector) getResources(ac *azure.Client, target Target, subscription azure.Subscription) ([]azure.Resource, error) {
+
+	filters := c.filters(target)
+
+	cached, err := discovery.Get("resources", fmt.Sprintf("%s/%s/%s", target.Credential, subscription.SubscriptionID, filtersKey(filters)), func() (interface{}, int, error) {
+		resources, err := ac.GetResources(subscription.SubscriptionID, azure.ParentFilters(filters)...)
+		expanded := ac.ExpandChildResources(resources.Value, config.ChildResources, filters...)
+		return expanded, len(expanded), err
+	})
 
 	if err != nil {
-		logger.Error("Failed to get access token: %v", err)
+		return nil, err
+	}
+
+	return cached.([]azure.Resource), nil
+}
+
+// collectResourceGraph collects the resources selected by the Resource Graph query of the target
+// across its subscriptions, returning the value of azure_up
+func (c *Collector) collectResourceGraph(ch chan<- prometheus.Metric, ac *azure.Client, target Target, subscriptions []azure.Subscription, resourceAggregation string) float64 {
+
+	if len(subscriptions) == 0 {
+		return 1
 	}
-	resources, err := ac.GetResources(c.tagValue)
+
+	ids := []string{}
+	bySubscriptionID := make(map[string]azure.Subscription)
+	for _, subscription := range subscriptions {
+		ids = append(ids, subscription.SubscriptionID)
+		bySubscriptionID[strings.ToLower(subscription.SubscriptionID)] = subscription
+	}
+
+	logger.Info(fmt.Sprintf("Query resources of target [ %s ] in Resource Graph", target.Name))
+
+	filters := c.filters(target)
+
+	cached, err := discovery.Get("resourceGraph", fmt.Sprintf("%s/%s/%s/%s", target.Credential, strings.Join(ids, ","), target.ResourceGraphQuery, filtersKey(filters)), func() (interface{}, int, error) {
+		resources, err := ac.QueryResources(ids, target.ResourceGraphQuery)
+		expanded := ac.ExpandChildResources(azure.FilterResources(resources, azure.ParentFilters(filters)...), config.ChildResources, filters...)
+		return expanded, len(expanded), err
+	})
 
 	if err != nil {
-		logger.Error("Failed to get all resources: %v", err)
+		logger.Error(fmt.Sprintf("Failed to query resources of target %s: %v", target.Name, err))
+		return 0
+	}
+
+	for _, resource := range cached.([]azure.Resource) {
+		subscription := bySubscriptionID[strings.ToLower(resourceSubscriptionID(resource.ID))]
+		c.collectResource(ch, ac, subscription, resource, resourceAggregation)
 	}
 
-	for _, resource := range resources.Value {
+	return 1
+}
 
-		if !azure.ValidateTypeMetric(resource.Type) {
-			continue
-		}
+// collectResource collects every metric of the resource. A resource reached through several
+// targets, or through subscriptions shared by several targets, is collected once per scrape,
+// since duplicated series would fail the whole scrape.
+func (c *Collector) collectResource(ch chan<- prometheus.Metric, ac *azure.Client, subscription azure.Subscription, resource azure.Resource, resourceAggregation string) {
 
-		logger.Info(fmt.Sprintf("Retrieves all metric definitions of resource [ %s ]", resource.Name))
+	if c.collected[strings.ToLower(resource.ID)] {
+		return
+	}
+	c.collected[strings.ToLower(resource.ID)] = true
 
-		typeMetrics, err := ac.GetMetricTypes(resource.ID, resource.Type)
+	c.resources = append(c.resources, resourceInfo{subscription: subscription, resource: resource})
 
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to get metrics types from resources %s: %v", resource.Name, err))
+	supported, probed := ac.ValidateTypeMetric(resource)
+	if !supported {
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Retrieves all metric definitions of resource [ %s ]", resource.Name))
+
+	cached, err := discovery.Get("definitions", resource.ID, func() (interface{}, int, error) {
+		// The probed definitions are only used once, later refreshes request them again
+		if probed != nil {
+			definitions := *probed
+			probed = nil
+			return definitions, len(definitions.MetricDefinitionResponses), nil
 		}
+		typeMetrics, err := ac.GetMetricTypes(resource.ID, resource.Type)
+		return typeMetrics, len(typeMetrics.MetricDefinitionResponses), err
+	})
+
+	var typeMetrics azure.MetricDefinitionResponse
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get metrics types from resources %s: %v", resource.Name, err))
+	} else {
+		typeMetrics = cached.(azure.MetricDefinitionResponse)
+	}
 
-		logger.Info(fmt.Sprintf("Treats metric definitions found from resource [ %s ]", resource.Name))
+	logger.Info(fmt.Sprintf("Treats metric definitions found from resource [ %s ]", resource.Name))
 
-		typeMetricsTreated := azure.TreatTypeMetric(typeMetrics)
+	for _, query := range metricQueries(resource, typeMetrics, resourceAggregation) {
 
-		for _, typeMetric := range typeMetricsTreated {
+		dimensions := azure.DimensionNames(query.Filter)
 
-			metricValueData, err := ac.GetMetric(resource.ID, typeMetric, resourceAggregation)
+		metricValueData, err := ac.GetMetric(resource.ID, query)
 
-			if err != nil {
-				logger.Error(fmt.Sprintf("Failed to get metrics for target %s: %v", resource.ID, err))
-				continue
-			}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get metrics for target %s: %v", resource.ID, err))
+			continue
+		}
 
-			if metricValueData.Value == nil {
-				logger.Error(fmt.Sprintf("Metric %v not found at target %v\n", typeMetric, resource.ID))
+		if metricValueData.Value == nil {
+			logger.Error(fmt.Sprintf("Metric %v not found at target %v\n", query.MetricNames, resource.ID))
+			continue
+		}
+		if len(metricValueData.Value) <= 0 || len(metricValueData.Value[0].Timeseries) <= 0 || len(metricValueData.Value[0].Timeseries[0].Data) == 0 {
+			logger.Error(fmt.Sprintf("No metric data returned for metric %v at target %v\n", query.MetricNames, resource.ID))
+			continue
+		}
+		for _, value := range metricValueData.Value {
+
+			defer recoverMetric(resource.Name, value.Name.Value)
+
+			if len(value.Timeseries) <= 0 || len(value.Timeseries[0].Data) <= 0 {
 				continue
 			}
-			if len(metricValueData.Value) <= 0 || len(metricValueData.Value[0].Timeseries) <= 0 || len(metricValueData.Value[0].Timeseries[0].Data) == 0 {
-				logger.Error(fmt.Sprintf("No metric data returned for metric %v at target %v\n", typeMetric, resource.ID))
-				continue
+
+			err := value.SanitizeMetric(resource.Type)
+
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to sanitize metrics %s: %v", resource.Name, err))
 			}
-			for _, value := range metricValueData.Value {
 
-				defer recoverMetric(resource.Name, value.Name.Value)
+			for _, timeseries := range value.Timeseries {
 
-				if len(value.Timeseries) <= 0 || len(value.Timeseries[0].Data) <= 0 {
+				if len(timeseries.Data) <= 0 {
 					continue
 				}
 
-				err := value.SanitizeMetric(resource.Type)
+				metricValue := timeseries.Data[len(timeseries.Data)-1]
 
-				if err != nil {
-					logger.Error(fmt.Sprintf("Failed to sanitize metrics %s: %v", resource.Name, err))
+				labels := CreateResourceLabels(value.ID, resource.Name, resource.Type, IdentifyEnvironmentResource(resource.Name), c.tagValue, resource.Tags, config.TagLabels)
+				labels["subscription_id"] = subscription.SubscriptionID
+				labels["subscription_name"] = subscription.DisplayName
+				labels["management_group"] = subscription.ManagementGroup
+				labels["parent_resource"] = resource.Parent
+				for name, dimension := range timeseries.DimensionLabels(dimensions) {
+					labels[name] = dimension
 				}
 
-				metricValue := value.Timeseries[0].Data[len(value.Timeseries[0].Data)-1]
-
-				labels := CreateResourceLabels(value.ID, resource.Name, resource.Type, IdentifyEnvironmentResource(resource.Name), c.tagValue)
-
-				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc(value.Name.Value+"_tot", value.Name.Value+"_tot", nil, labels),
-					prometheus.GaugeValue,
-					metricValue.Total,
-				)
-
-				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc(value.Name.Value+"_avg", value.Name.Value+"_avg", nil, labels),
-					prometheus.GaugeValue,
-					metricValue.Average,
-				)
-
-				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc(value.Name.Value+"_min", value.Name.Value+"_min", nil, labels),
-					prometheus.GaugeValue,
-					metricValue.Minimum,
-				)
-
-				ch <- prometheus.MustNewConstMetric(
-					prometheus.NewDesc(value.Name.Value+"_max", value.Name.Value+"_max", nil, labels),
-					prometheus.GaugeValue,
-					metricValue.Maximum,
-				)
+				for _, aggregation := range strings.Split(query.Aggregation, ",") {
+					name := value.Name.Value + azure.AggregationSuffix(aggregation)
+					ch <- prometheus.MustNewConstMetric(
+						prometheus.NewDesc(name, name, nil, labels),
+						prometheus.GaugeValue,
+						metricValue.Value(aggregation),
+					)
+				}
 			}
 		}
 	}
+}
 
-	logger.Info("Finally Get all resources")
+// metricQueries groups the metrics of the resource into requests. Each metric is requested with
+// the aggregations configured for it, or given by metricAggregation, that its definition supports,
+// and with its primary aggregation by default, over the window configured for it. Metrics split by
+// dimensions are requested one by one with their $filter, which Azure Monitor rejects with several
+// metric names, and the other metrics are requested together with the metrics sharing their
+// aggregations and window.
+func metricQueries(resource azure.Resource, typeMetrics azure.MetricDefinitionResponse, aggregation string) []azure.MetricQuery {
+
+	type group struct {
+		aggregations string
+		window       azure.MetricWindow
+	}
+
+	queries := []azure.MetricQuery{}
+	combined := make(map[group]*azure.MetricDefinitionResponse)
+	order := []group{}
+
+	for _, definition := range typeMetrics.MetricDefinitionResponses {
+
+		requested := splitList(aggregation)
+		if override := config.metricAggregation(resource.Type, definition.Name.Value); override != nil {
+			requested = override.Aggregations
+		}
+		aggregations := strings.Join(azure.SelectAggregations(requested, definition.PrimaryAggregationType, definition.SupportedAggregationTypes), ",")
+		window := config.metricWindow(resource.Type, definition.Name.Value, definition.SmallestTimeGrain())
+
+		dimension := config.metricDimension(resource.Type, definition.Name.Value)
+		if dimension == nil {
+			key := group{aggregations, window}
+			if combined[key] == nil {
+				combined[key] = &azure.MetricDefinitionResponse{}
+				order = append(order, key)
+			}
+			combined[key].MetricDefinitionResponses = append(combined[key].MetricDefinitionResponses, definition)
+			continue
+		}
+
+		queries = append(queries, azure.MetricQuery{
+			MetricNames: definition.Name.Value,
+			Aggregation: aggregations,
+			Filter:      dimension.Filter,
+			Top:         dimension.Top,
+			Window:      window,
+		})
+	}
 
+	for _, key := range order {
+		for _, metricNames := range azure.TreatTypeMetric(*combined[key]) {
+			queries = append(queries, azure.MetricQuery{MetricNames: metricNames, Aggregation: key.aggregations, Window: key.window})
+		}
+	}
+
+	return queries
 }
 
 func recoverMetric(resource, metric string) {
@@ -150,9 +359,20 @@ func recoverMetric(resource, metric string) {
 
 func handler(w http.ResponseWriter, r *http.Request) {
 	registry := prometheus.NewRegistry()
-	collector := &Collector{tagValue: r.URL.Query().Get("tagValue")}
+	query := r.URL.Query()
+	filter, err := azure.ParseResourceFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collector := &Collector{
+		tagValue: query.Get("tagValue"),
+		filter:   filter,
+		targets:  config.SelectTargets(query.Get("credential"), query.Get("target")),
+	}
 	registry.MustRegister(collector)
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+	h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 }
 
@@ -160,6 +380,19 @@ func main() {
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 
+	var err error
+	config, err = LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	discovery = newDiscoveryCache(*cacheTTL)
+	if *cacheTTL > 0 {
+		go discovery.run(*cacheTTL/4, nil)
+	}
+	azure.SetMetricTypeOverrides(config.SupportedResourceTypes, config.UnsupportedResourceTypes)
+	azure.SetMetricTypeTTL(*cacheTTL)
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
             <head>
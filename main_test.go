@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricQueriesSplitsDimensionedMetrics(t *testing.T) {
+
+	config = Config{MetricDimensions: []azure.MetricDimension{
+		{ResourceType: "Microsoft.ServiceBus/namespaces", Metric: "IncomingMessages", Filter: "EntityName eq '*'", Top: 50},
+	}}
+	defer func() { config = Config{} }()
+
+	var definitions azure.MetricDefinitionResponse
+	err := json.Unmarshal([]byte(`{"value":[{"name":{"value":"IncomingMessages"}},{"name":{"value":"OutgoingMessages"}},{"name":{"value":"ActiveConnections"}}]}`), &definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := azure.Resource{Type: "Microsoft.ServiceBus/namespaces"}
+	queries := metricQueries(resource, definitions, "Total")
+
+	if len(queries) != 2 {
+		t.Fatalf(errorMessageQuantity, "2", fmt.Sprint(len(queries)))
+	}
+
+	if queries[0].MetricNames != "IncomingMessages" || queries[0].Filter != "EntityName eq '*'" || queries[0].Top != 50 {
+		t.Errorf(errorMessageData, "IncomingMessages", fmt.Sprint(queries[0]))
+	}
+
+	if queries[1].MetricNames != "OutgoingMessages,ActiveConnections" || queries[1].Filter != "" {
+		t.Errorf(errorMessageData, "OutgoingMessages,ActiveConnections", fmt.Sprint(queries[1]))
+	}
+
+	resource.Type = "Microsoft.EventHub/namespaces"
+	if queries := metricQueries(resource, definitions, "Total"); len(queries) != 1 {
+		t.Errorf(errorMessageQuantity, "1", fmt.Sprint(len(queries)))
+	}
+}
+
+func TestMetricQueriesGroupsMetricsByAggregations(t *testing.T) {
+
+	config = Config{MetricAggregations: []MetricAggregation{
+		{ResourceType: "Microsoft.Web/sites", Metric: "Requests", Aggregations: []string{"Total", "Count"}},
+	}}
+	defer func() { config = Config{} }()
+
+	var definitions azure.MetricDefinitionResponse
+	err := json.Unmarshal([]byte(`{"value":[
+		{"name":{"value":"CpuTime"},"primaryAggregationType":"Total","supportedAggregationTypes":["Total","Average"]},
+		{"name":{"value":"Requests"},"primaryAggregationType":"Total","supportedAggregationTypes":["Total","Count"]},
+		{"name":{"value":"MemoryWorkingSet"},"primaryAggregationType":"Average","supportedAggregationTypes":["Average","Maximum"]},
+		{"name":{"value":"BytesSent"},"primaryAggregationType":"Total"}
+	]}`), &definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := metricQueries(azure.Resource{Type: "Microsoft.Web/sites"}, definitions, "")
+
+	expected := map[string]string{"CpuTime,BytesSent": "Total", "Requests": "Total,Count", "MemoryWorkingSet": "Average"}
+	if len(queries) != len(expected) {
+		t.Fatalf(errorMessageQuantity, "3", fmt.Sprint(len(queries)))
+	}
+
+	for _, query := range queries {
+		if expected[query.MetricNames] != query.Aggregation {
+			t.Errorf(errorMessageData, expected[query.MetricNames], fmt.Sprint(query))
+		}
+	}
+
+	queries = metricQueries(azure.Resource{Type: "Microsoft.Web/sites"}, definitions, "Maximum,Minimum")
+	for _, query := range queries {
+		if query.MetricNames == "MemoryWorkingSet" && query.Aggregation != "Maximum" {
+			t.Errorf(errorMessageData, "Maximum", query.Aggregation)
+		}
+	}
+}
+
+func TestMetricQueriesGroupsMetricsByWindow(t *testing.T) {
+
+	offset := 5 * time.Minute
+	config = Config{MetricWindows: []MetricWindow{
+		{ResourceType: "Microsoft.Storage/storageAccounts", Metric: "Transactions", Timespan: 15 * time.Minute},
+		{Offset: &offset},
+	}}
+	defer func() { config = Config{} }()
+
+	var definitions azure.MetricDefinitionResponse
+	err := json.Unmarshal([]byte(`{"value":[
+		{"name":{"value":"UsedCapacity"},"primaryAggregationType":"Average","metricAvailabilities":[{"timeGrain":"PT1H"}]},
+		{"name":{"value":"Transactions"},"primaryAggregationType":"Total","metricAvailabilities":[{"timeGrain":"PT1M"},{"timeGrain":"PT1H"}]},
+		{"name":{"value":"Ingress"},"primaryAggregationType":"Total","metricAvailabilities":[{"timeGrain":"PT1M"},{"timeGrain":"PT5M"}]},
+		{"name":{"value":"Egress"},"primaryAggregationType":"Total","metricAvailabilities":[{"timeGrain":"PT1M"}]}
+	]}`), &definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queries := metricQueries(azure.Resource{Type: "Microsoft.Storage/storageAccounts"}, definitions, "")
+
+	if len(queries) != 3 {
+		t.Fatalf(errorMessageQuantity, "3", fmt.Sprint(len(queries)))
+	}
+
+	expected := map[string]azure.MetricWindow{
+		"UsedCapacity":   {Timespan: time.Hour, Interval: time.Hour, Offset: 5 * time.Minute},
+		"Transactions":   {Timespan: 15 * time.Minute, Interval: time.Minute, Offset: 5 * time.Minute},
+		"Ingress,Egress": {Timespan: time.Minute, Interval: time.Minute, Offset: 5 * time.Minute},
+	}
+	for _, query := range queries {
+		if window, ok := expected[query.MetricNames]; !ok || query.Window != window {
+			t.Errorf(errorMessageData, expected[query.MetricNames], fmt.Sprint(query))
+		}
+	}
+}
+
+func TestCollectResourceOncePerScrape(t *testing.T) {
+
+	resource := azure.Resource{ID: "/subscriptions/subscription-a/resourceGroups/rg/providers/Microsoft.Web/sites/a", Name: "a"}
+	collector := &Collector{collected: map[string]bool{strings.ToLower(resource.ID): true}}
+
+	ch := make(chan prometheus.Metric, 10)
+	collector.collectResource(ch, nil, azure.Subscription{SubscriptionID: "subscription-a"}, resource, "")
+	close(ch)
+
+	if len(ch) != 0 || len(collector.resources) != 0 {
+		t.Errorf(errorMessageQuantity, "0", fmt.Sprint(len(collector.resources)))
+	}
+}
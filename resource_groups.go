@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+	"github.com/dasa-health/elk-logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var resourceGroupUpDesc = prometheus.NewDesc("azure_resource_group_up", "Whether the resources of the resource group could be listed.", []string{"target", "subscription_id", "resource_group"}, nil)
+
+// ResolveResourceGroups returns the resource groups of the target in the subscription: the names
+// listed, and the resource groups readable with the credential matching one of the patterns. The
+// names are still returned when the resource groups cannot be listed.
+func (target *Target) ResolveResourceGroups(ac *azure.Client, subscription azure.Subscription) ([]string, error) {
+
+	resourceGroups := append([]string{}, target.resourceGroupNames...)
+
+	if len(target.resourceGroupPatterns) == 0 {
+		return resourceGroups, nil
+	}
+
+	cached, err := discovery.Get("resourceGroups", fmt.Sprintf("%s/%s", target.Credential, subscription.SubscriptionID), func() (interface{}, int, error) {
+		listed, err := ac.GetResourceGroups(subscription.SubscriptionID)
+		return listed, len(listed), err
+	})
+
+	if err != nil {
+		return resourceGroups, fmt.Errorf("Error listing resource groups: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range resourceGroups {
+		seen[strings.ToLower(name)] = true
+	}
+
+	for _, resourceGroup := range cached.([]azure.ResourceGroup) {
+		if seen[strings.ToLower(resourceGroup.Name)] {
+			continue
+		}
+		for _, pattern := range target.resourceGroupPatterns {
+			if pattern.MatchString(resourceGroup.Name) {
+				seen[strings.ToLower(resourceGroup.Name)] = true
+				resourceGroups = append(resourceGroups, resourceGroup.Name)
+				break
+			}
+		}
+	}
+
+	return resourceGroups, nil
+}
+
+// collectResourceGroups collects the resources of each resource group of the target in the
+// subscription. A resource group that cannot be listed, for example because the credential is
+// not allowed to read it, is reported by azure_resource_group_up without failing the others.
+// It returns the value of azure_up for the subscription.
+func (c *Collector) collectResourceGroups(ch chan<- prometheus.Metric, ac *azure.Client, target Target, subscription azure.Subscription, resourceAggregation string) float64 {
+
+	up := 1.0
+
+	resourceGroups, err := target.ResolveResourceGroups(ac, subscription)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to resolve resource groups of subscription %s in target %s: %v", subscription.SubscriptionID, target.Name, err))
+		up = 0
+	}
+
+	filters := c.filters(target)
+
+	for _, resourceGroup := range resourceGroups {
+		resourceGroup := resourceGroup
+
+		logger.Info(fmt.Sprintf("Get all resources of resource group [ %s ]", resourceGroup))
+
+		cached, err := discovery.Get("resources", fmt.Sprintf("%s/%s/%s/%s", target.Credential, subscription.SubscriptionID, resourceGroup, filtersKey(filters)), func() (interface{}, int, error) {
+			resources, err := ac.GetResourceGroupResources(subscription.SubscriptionID, resourceGroup, azure.ParentFilters(filters)...)
+			expanded := ac.ExpandChildResources(resources.Value, config.ChildResources, filters...)
+			return expanded, len(expanded), err
+		})
+
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get all resources of resource group %s of subscription %s in target %s: %v", resourceGroup, subscription.SubscriptionID, target.Name, err))
+			ch <- prometheus.MustNewConstMetric(resourceGroupUpDesc, prometheus.GaugeValue, 0, target.Name, subscription.SubscriptionID, resourceGroup)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(resourceGroupUpDesc, prometheus.GaugeValue, 1, target.Name, subscription.SubscriptionID, resourceGroup)
+
+		for _, resource := range cached.([]azure.Resource) {
+			c.collectResource(ch, ac, subscription, resource, resourceAggregation)
+		}
+	}
+
+	return up
+}
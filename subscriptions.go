@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+	"github.com/dasa-health/elk-logger"
+)
+
+// managementGroups caches the subscriptions found below the management group of each target
+var managementGroups = struct {
+	sync.Mutex
+	entries map[string]managementGroupEntry
+}{entries: make(map[string]managementGroupEntry)}
+
+type managementGroupEntry struct {
+	subscriptions []azure.Subscription
+	fetched       time.Time
+}
+
+// ResolveSubscriptions returns the subscriptions scraped for the target. Listed subscriptions
+// are named after the accessible subscriptions of the credential when they can be listed,
+// while allSubscriptions requires the listing and keeps only the enabled subscriptions.
+// Subscriptions below the management group of the target are added to the listed ones. The
+// accessible subscriptions of each credential are kept in the discovery cache.
+func (target *Target) ResolveSubscriptions(ac *azure.Client) ([]azure.Subscription, error) {
+
+	var accessible []azure.Subscription
+	cached, err := discovery.Get("subscriptions", target.Credential, func() (interface{}, int, error) {
+		listed, err := ac.GetSubscriptions()
+		return listed, len(listed), err
+	})
+	if err == nil {
+		accessible = cached.([]azure.Subscription)
+	} else {
+		if target.AllSubscriptions {
+			return nil, fmt.Errorf("Error listing subscriptions: %v", err)
+		}
+		logger.Error(fmt.Sprintf("Failed to list subscriptions of target %s, subscription names are left empty: %v", target.Name, err))
+	}
+
+	candidates := []azure.Subscription{}
+
+	if target.AllSubscriptions {
+		for _, subscription := range accessible {
+			if subscription.State == "Enabled" {
+				candidates = append(candidates, subscription)
+			}
+		}
+	} else {
+		ids := target.Subscriptions
+		if !target.SubscriptionID.IsEmpty() {
+			value, err := target.SubscriptionID.Value()
+			if err != nil {
+				return nil, fmt.Errorf("Error reading subscriptionId: %v", err)
+			}
+			ids = append(splitList(value), ids...)
+		}
+
+		names := make(map[string]string)
+		for _, subscription := range accessible {
+			names[subscription.SubscriptionID] = subscription.DisplayName
+		}
+
+		for _, id := range ids {
+			candidates = append(candidates, azure.Subscription{SubscriptionID: id, DisplayName: names[id]})
+		}
+
+		if target.ManagementGroup != "" {
+			descendants, err := target.managementGroupSubscriptions(ac)
+			if err != nil {
+				return nil, err
+			}
+
+			// The descendants API does not return the state, which is known from the listing
+			states := make(map[string]string)
+			for _, subscription := range accessible {
+				states[subscription.SubscriptionID] = subscription.State
+			}
+
+			for _, subscription := range descendants {
+				if accessible != nil && states[subscription.SubscriptionID] != "Enabled" {
+					continue
+				}
+				candidates = append(candidates, subscription)
+			}
+		}
+	}
+
+	subscriptions := []azure.Subscription{}
+	seen := make(map[string]bool)
+	for _, subscription := range candidates {
+		if seen[subscription.SubscriptionID] || !target.matchSubscription(subscription) {
+			continue
+		}
+		seen[subscription.SubscriptionID] = true
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// managementGroupSubscriptions returns the subscriptions below the management group of the target,
+// listing them again once managementGroupRefresh has elapsed. The previous list is kept when
+// listing fails.
+func (target *Target) managementGroupSubscriptions(ac *azure.Client) ([]azure.Subscription, error) {
+	managementGroups.Lock()
+	entry, ok := managementGroups.entries[target.Name]
+	managementGroups.Unlock()
+
+	if ok && time.Since(entry.fetched) < target.ManagementGroupRefresh {
+		return entry.subscriptions, nil
+	}
+
+	// The lock is not held while listing, so a slow management group does not block other targets
+	subscriptions, err := ac.GetManagementGroupSubscriptions(target.ManagementGroup)
+	if err != nil {
+		if ok {
+			logger.Error(fmt.Sprintf("Failed to refresh management group %s of target %s, keeping %d known subscriptions: %v", target.ManagementGroup, target.Name, len(entry.subscriptions), err))
+			return entry.subscriptions, nil
+		}
+		return nil, fmt.Errorf("Error listing subscriptions of management group %s: %v", target.ManagementGroup, err)
+	}
+
+	logger.Info(fmt.Sprintf("Found %d subscriptions below management group [ %s ]", len(subscriptions), target.ManagementGroup))
+
+	managementGroups.Lock()
+	managementGroups.entries[target.Name] = managementGroupEntry{subscriptions: subscriptions, fetched: time.Now()}
+	managementGroups.Unlock()
+
+	return subscriptions, nil
+}
+
+// resourceSubscriptionID returns the subscription ID of the resource ID
+func resourceSubscriptionID(resourceID string) string {
+	parts := strings.Split(resourceID, "/")
+	if len(parts) < 3 || !strings.EqualFold(parts[1], "subscriptions") {
+		return ""
+	}
+
+	return parts[2]
+}
+
+// matchSubscription checks the subscription ID and name against the include and exclude patterns
+func (target *Target) matchSubscription(subscription azure.Subscription) bool {
+
+	if len(target.include) > 0 && !matchAny(target.include, subscription.SubscriptionID, subscription.DisplayName) {
+		return false
+	}
+
+	return !matchAny(target.exclude, subscription.SubscriptionID, subscription.DisplayName)
+}
+
+func matchAny(patterns []*regexp.Regexp, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if value != "" && pattern.MatchString(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
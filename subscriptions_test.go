@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dasa-health/azure_metrics_exporter/azure"
+)
+
+func TestResourceSubscriptionID(t *testing.T) {
+
+	conditions := map[string]string{
+		"/subscriptions/subscription-a/resourceGroups/rg/providers/Microsoft.Web/sites/site": "subscription-a",
+		"/SUBSCRIPTIONS/subscription-b/resourceGroups/rg":                                    "subscription-b",
+		"/providers/Microsoft.Management/managementGroups/corp":                              "",
+		"": "",
+	}
+
+	for resourceID, expected := range conditions {
+		if subscriptionID := resourceSubscriptionID(resourceID); subscriptionID != expected {
+			t.Errorf(errorMessageData, expected, subscriptionID)
+		}
+	}
+}
+
+func TestResolveSubscriptionsCachesListing(t *testing.T) {
+
+	var listings int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			fmt.Fprintf(w, `{"access_token":"token","expires_on":"%d","token_type":"Bearer"}`, time.Now().Add(time.Hour).Unix())
+		case "/subscriptions":
+			atomic.AddInt32(&listings, 1)
+			fmt.Fprint(w, `{"value":[{"subscriptionId":"subscription-a","displayName":"Payments","state":"Enabled"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	discovery = newDiscoveryCache(time.Hour)
+	defer func() { discovery = newDiscoveryCache(0) }()
+
+	// Clients are cached by name, a new name keeps a repeated run off the closed server
+	name := fmt.Sprintf("subscriptions-cache-%d", time.Now().UnixNano())
+	ac, err := azure.GetClient(name, azure.CredentialConfig{
+		AuthMethod:              "managed_identity",
+		ManagedIdentityEndpoint: server.URL + "/token",
+		Cloud:                   "custom",
+		AuthorityHost:           server.URL + "/",
+		ResourceManagerEndpoint: server.URL + "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := Target{Name: "payments", Credential: name, SubscriptionID: azure.NewSecret("subscription-a")}
+
+	for i := 0; i < 3; i++ {
+		subscriptions, err := target.ResolveSubscriptions(&ac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subscriptions) != 1 || subscriptions[0].DisplayName != "Payments" {
+			t.Errorf(errorMessageData, "Payments", fmt.Sprint(subscriptions))
+		}
+	}
+
+	if count := atomic.LoadInt32(&listings); count != 1 {
+		t.Errorf(errorMessageQuantity, "1", strconv.Itoa(int(count)))
+	}
+}
+
+func TestResolveSubscriptionsSkipsDisabledManagementGroupSubscriptions(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			fmt.Fprintf(w, `{"access_token":"token","expires_on":"%d","token_type":"Bearer"}`, time.Now().Add(time.Hour).Unix())
+		case "/subscriptions":
+			fmt.Fprint(w, `{"value":[{"subscriptionId":"subscription-a","state":"Enabled"},{"subscriptionId":"subscription-b","state":"Disabled"}]}`)
+		case "/providers/Microsoft.Management/managementGroups/corp/descendants":
+			fmt.Fprint(w, `{"value":[{"type":"/subscriptions","name":"subscription-a"},{"type":"/subscriptions","name":"subscription-b"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	name := fmt.Sprintf("management-group-%d", time.Now().UnixNano())
+	ac, err := azure.GetClient(name, azure.CredentialConfig{
+		AuthMethod:              "managed_identity",
+		ManagedIdentityEndpoint: server.URL + "/token",
+		Cloud:                   "custom",
+		AuthorityHost:           server.URL + "/",
+		ResourceManagerEndpoint: server.URL + "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := Target{Name: name, Credential: name, ManagementGroup: "corp", ManagementGroupRefresh: time.Hour}
+
+	subscriptions, err := target.ResolveSubscriptions(&ac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subscriptions) != 1 || subscriptions[0].SubscriptionID != "subscription-a" {
+		t.Errorf(errorMessageData, "subscription-a", fmt.Sprint(subscriptions))
+	}
+}
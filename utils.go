@@ -5,13 +5,22 @@ import (
 )
 
 // CreateResourceLabels - Returns resource labels for a give resource ID.
-func CreateResourceLabels(resourceID, resourceName, resourceType, environment, projectName string) map[string]string {
+func CreateResourceLabels(resourceID, resourceName, resourceType, environment, projectName string, tags map[string]string, tagLabels []TagLabel) map[string]string {
 	labels := make(map[string]string)
 	labels["resource_group"] = strings.Split(resourceID, "/")[4]
 	labels["resource_type"] = resourceType
 	labels["resource_name"] = resourceName
 	labels["resource_environment"] = environment
 	labels["resource_project_name"] = projectName
+	for _, tagLabel := range tagLabels {
+		labels[tagLabel.Label] = tagLabel.Default
+		for name, value := range tags {
+			if strings.EqualFold(name, tagLabel.Tag) && value != "" {
+				labels[tagLabel.Label] = value
+				break
+			}
+		}
+	}
 	return labels
 }
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -74,7 +75,7 @@ func TestCreateResourceLabelsValidScenarios(t *testing.T) {
 
 	for _, condition := range conditions {
 
-		dataReturn := CreateResourceLabels(condition.ID, condition.name, condition.resourceType, condition.environment, condition.projectName)
+		dataReturn := CreateResourceLabels(condition.ID, condition.name, condition.resourceType, condition.environment, condition.projectName, nil, nil)
 
 		if dataReturn["resource_group"] == "" || dataReturn["resource_group"] != strings.Split(condition.ID, "/")[4] {
 			t.Error(errorMessageData, dataReturn["resource_group"], strings.Split(condition.ID, "/")[4])
@@ -97,3 +98,27 @@ func TestCreateResourceLabelsValidScenarios(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateResourceLabelsTagLabels(t *testing.T) {
+
+	tagLabels := []TagLabel{
+		{Tag: "cost-center", Label: "tag_cost_center"},
+		{Tag: "owner", Label: "team"},
+		{Tag: "service", Label: "tag_service", Default: "unknown"},
+	}
+	tags := map[string]string{"Cost-Center": "42", "owner": "payments"}
+
+	labels := CreateResourceLabels("/subscriptions/s/resourceGroups/rg/providers/Microsoft.Web/sites/site", "site", "Microsoft.Web/sites", "prd", "project", tags, tagLabels)
+
+	expected := map[string]string{"tag_cost_center": "42", "team": "payments", "tag_service": "unknown"}
+	for label, value := range expected {
+		if labels[label] != value {
+			t.Errorf(errorMessageData, value, labels[label])
+		}
+	}
+
+	labels = CreateResourceLabels("/subscriptions/s/resourceGroups/rg/providers/Microsoft.Web/sites/site", "site", "Microsoft.Web/sites", "prd", "project", nil, tagLabels)
+	if _, ok := labels["team"]; !ok || len(labels) != 8 {
+		t.Errorf(errorMessageQuantity, "8", fmt.Sprint(len(labels)))
+	}
+}